@@ -2,17 +2,17 @@ package main
 
 import (
 	"context"
+	"io"
 	"log"
 	"sync"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-
+	"github.com/renderinc/render-auditlogs/pkg/archive"
 	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
-	"github.com/renderinc/render-auditlogs/pkg/aws"
 	"github.com/renderinc/render-auditlogs/pkg/env"
 	"github.com/renderinc/render-auditlogs/pkg/logger"
 	"github.com/renderinc/render-auditlogs/pkg/processor"
 	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/sink"
 )
 
 const (
@@ -29,17 +29,50 @@ func main() {
 		log.Fatal("Error loading config:", err)
 	}
 
-	// Create S3 uploader
-	uploader, err := aws.NewUploaderWithOptions(ctx, s3.NewFromConfig(cfg.AWSConfig), cfg.S3Bucket, cfg.AWSRegion, aws.UploaderOptions{
-		UseKMS:           cfg.S3UseKMS,
-		KMSKeyID:         cfg.S3KMSKeyID,
-		BucketKeyEnabled: cfg.S3BucketKeyEnabled,
-	})
+	// Batches only follow the object partitioning and key layout for sinks
+	// that write objects. Other sinks get whole windows, so sinks that commit
+	// their own checkpoint never do so in the middle of one.
+	var processorOpts processor.Options
+	if sink.IsArchive(&cfg) {
+		archiveOpts, err := archive.OptionsFromConfig(&cfg)
+		if err != nil {
+			log.Fatal("Error loading object options:", err)
+		}
+		processorOpts = processor.Options{
+			Partition:    archiveOpts.Partition,
+			SplitByEvent: archiveOpts.KeyIncludesEvent(),
+		}
+	}
+
+	auditLogSink, err := sink.New(ctx, &cfg)
 	if err != nil {
-		log.Fatal("Error creating S3 uploader:", err)
+		log.Fatal("Error creating sink:", err)
+	}
+	if closer, ok := auditLogSink.(io.Closer); ok {
+		defer closer.Close()
 	}
 
-	client := render.NewClient(renderAPIBaseURL, cfg.RenderAPIKey)
+	checkpoints, err := sink.NewCheckpointStore(ctx, &cfg)
+	if err != nil {
+		log.Fatal("Error creating checkpoint store:", err)
+	}
+	if closer, ok := checkpoints.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	client := render.NewClientWithOptions(renderAPIBaseURL, cfg.RenderAPIKey, render.ClientOptions{
+		Timeout: cfg.RenderRequestTimeout,
+		Retry: render.RetryPolicy{
+			MaxAttempts:    cfg.RenderRetryMaxAttempts,
+			InitialBackoff: cfg.RenderRetryInitialBackoff,
+			MaxBackoff:     cfg.RenderRetryMaxBackoff,
+		},
+	})
+
+	// Canceled when the Render API rejects the API key, since every remaining
+	// target would fail the same way
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	workspaceLogs := auditlogs.NewWorkspaceSvc(client)
 	organizationLogs := auditlogs.NewOrganizationSvc(client)
@@ -49,6 +82,10 @@ func main() {
 
 	for _, workspaceID := range cfg.WorkspaceIDS {
 		semaphore <- 1
+		if ctx.Err() != nil {
+			<-semaphore
+			break
+		}
 		wg.Add(1)
 
 		go func(workspaceID string) {
@@ -60,18 +97,21 @@ func main() {
 			ctx, l := logger.With(ctx, "workspaceID", workspaceID)
 
 			l.Info("processing workspace")
-			err := processor.NewLogProcessor(
-				uploader, workspaceLogs,
+			err := processor.NewLogProcessorWithOptions(
+				auditLogSink, checkpoints, workspaceLogs, processorOpts,
 			).Process(ctx, workspaceID)
 
 			if err != nil {
 				l.Error("Error processing workspace", "error", err)
+				if render.IsUnauthorized(err) {
+					cancel()
+				}
 			}
 
 		}(workspaceID)
 	}
 
-	if cfg.OrganizationID != "" {
+	if cfg.OrganizationID != "" && ctx.Err() == nil {
 		semaphore <- 1
 		wg.Add(1)
 		go func(organizationID string) {
@@ -82,12 +122,15 @@ func main() {
 
 			ctx, l := logger.With(ctx, "organizationID", cfg.OrganizationID)
 			l.Info("processing enterprise")
-			err = processor.NewLogProcessor(
-				uploader, organizationLogs,
+			err := processor.NewLogProcessorWithOptions(
+				auditLogSink, checkpoints, organizationLogs, processorOpts,
 			).Process(ctx, cfg.OrganizationID)
 
 			if err != nil {
 				l.Error("Error processing organization audit logs", "error", err)
+				if render.IsUnauthorized(err) {
+					cancel()
+				}
 			}
 		}(cfg.OrganizationID)
 	}
@@ -0,0 +1,238 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+const checkpointKey = "checkpoint.json"
+
+// Object is an encoded batch of audit logs, ready to be written to object
+// storage
+type Object struct {
+	Key         string
+	Body        []byte
+	ContentType string
+	// ContentEncoding is set when clients should transparently decode Body,
+	// and is empty for objects stored as compressed files
+	ContentEncoding string
+}
+
+// Options control how objects are encoded. The zero value writes gzip
+// compressed JSON arrays.
+type Options struct {
+	Format Format
+	// Compression is the codec of JSON and NDJSON objects
+	Compression Compression
+	// GzipLevel is from 1 (fastest) to 9 (smallest), 0 uses the default
+	GzipLevel int
+	// ContentEncoding stores compressed objects with the format's content
+	// type and a Content-Encoding, so HTTP clients decompress them
+	// transparently, rather than as compressed files
+	ContentEncoding bool
+	// ParquetCompression is the column codec of Parquet objects, one of
+	// snappy (the default), zstd, gzip or none
+	ParquetCompression string
+	// Partition is the time span of each key's partition, daily by default
+	Partition Granularity
+	// ZeroPadPartitions writes month=01/day=05 rather than month=1/day=5, so
+	// partitions sort lexically
+	ZeroPadPartitions bool
+	// KeyPrefix is prepended to every object key, but not to checkpoints
+	KeyPrefix string
+	// KeyTemplate lays out object keys below the prefix, e.g.
+	// {type}/{id}/dt={date}/{batch}. The extension is appended to it. Defaults
+	// to the Hive-style layout of defaultKeyTemplate.
+	KeyTemplate string
+}
+
+// OptionsFromConfig validates the object settings in cfg
+func OptionsFromConfig(cfg *env.Config) (Options, error) {
+	format, err := ParseFormat(cfg.ObjectFormat)
+	if err != nil {
+		return Options{}, err
+	}
+
+	compression, err := ParseCompression(cfg.ObjectCompression)
+	if err != nil {
+		return Options{}, err
+	}
+
+	if cfg.ObjectGzipLevel < 0 || cfg.ObjectGzipLevel > 9 {
+		return Options{}, fmt.Errorf("OBJECT_GZIP_LEVEL must be 0 (default) or from 1 to 9, got %d", cfg.ObjectGzipLevel)
+	}
+
+	if _, err := parseParquetCompression(cfg.ObjectParquetCompression); err != nil {
+		return Options{}, err
+	}
+
+	partition, err := ParseGranularity(cfg.ObjectPartition)
+	if err != nil {
+		return Options{}, err
+	}
+
+	if _, err := parseKeyTemplate(cfg.ObjectKeyTemplate, partition); err != nil {
+		return Options{}, err
+	}
+
+	if err := validatePrefix(cfg.ObjectKeyPrefix); err != nil {
+		return Options{}, err
+	}
+
+	return Options{
+		Format:             format,
+		Compression:        compression,
+		GzipLevel:          cfg.ObjectGzipLevel,
+		ContentEncoding:    cfg.ObjectContentEncoding,
+		ParquetCompression: cfg.ObjectParquetCompression,
+		Partition:          partition,
+		ZeroPadPartitions:  cfg.ObjectZeroPadPartitions,
+		KeyPrefix:          cfg.ObjectKeyPrefix,
+		KeyTemplate:        cfg.ObjectKeyTemplate,
+	}, nil
+}
+
+// NewObject marshals and compresses a batch of audit logs and generates its
+// partitioned key
+func NewObject(auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry, opts Options) (*Object, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no audit logs to encode")
+	}
+
+	format, err := ParseFormat(string(opts.Format))
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Partition, err = ParseGranularity(string(opts.Partition)); err != nil {
+		return nil, err
+	}
+
+	tmpl, err := parseKeyTemplate(opts.KeyTemplate, opts.Partition)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validatePrefix(opts.KeyPrefix); err != nil {
+		return nil, err
+	}
+
+	if tmpl.has(PlaceholderEvent) {
+		for _, entry := range data[1:] {
+			if entry.AuditLog.Event != data[0].AuditLog.Event {
+				return nil, fmt.Errorf("key template contains {%s} but the batch has %s and %s events", PlaceholderEvent, data[0].AuditLog.Event, entry.AuditLog.Event)
+			}
+		}
+	}
+
+	if format == FormatParquet {
+		return newParquetObject(tmpl, auditLogType, id, data, opts)
+	}
+
+	compression, err := ParseCompression(string(opts.Compression))
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are encoded straight into the compressor, and hashed on the way
+	// for the key, so only the compressed body is buffered
+	var body bytes.Buffer
+	cw, err := compression.newWriter(&body, opts.GzipLevel)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s writer: %w", compression, err)
+	}
+
+	h := sha256.New()
+	if err := format.encode(io.MultiWriter(h, cw), data); err != nil {
+		return nil, fmt.Errorf("error encoding audit logs: %w", err)
+	}
+	if err := cw.Close(); err != nil {
+		return nil, fmt.Errorf("error closing %s writer: %w", compression, err)
+	}
+
+	obj := &Object{
+		Key:         generateKey(tmpl, opts, auditLogType, id, data[0].AuditLog, format.Extension()+compression.Extension(), h),
+		Body:        body.Bytes(),
+		ContentType: compression.ContentType(),
+	}
+	if compression == CompressionNone || opts.ContentEncoding {
+		obj.ContentType = format.ContentType()
+		obj.ContentEncoding = compression.ContentEncoding()
+	}
+
+	return obj, nil
+}
+
+// newParquetObject encodes a batch as Parquet, which compresses its columns
+// itself. The key is hashed over the batch as JSON so it doesn't depend on
+// the Parquet writer's output.
+func newParquetObject(tmpl *keyTemplate, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry, opts Options) (*Object, error) {
+	codec, err := parseParquetCompression(opts.ParquetCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := encodeParquet(data, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	if err := FormatJSON.encode(h, data); err != nil {
+		return nil, fmt.Errorf("error encoding audit logs: %w", err)
+	}
+
+	return &Object{
+		Key:         generateKey(tmpl, opts, auditLogType, id, data[0].AuditLog, FormatParquet.Extension(), h),
+		Body:        body,
+		ContentType: FormatParquet.ContentType(),
+	}, nil
+}
+
+// CheckpointKey returns the key of the checkpoint for a workspace or
+// organization. It doesn't depend on the key prefix, so setting or changing
+// the prefix resumes from the existing checkpoint.
+func CheckpointKey(auditLogType auditlogs.LogType, id string) string {
+	return fmt.Sprintf("%s=%s/%s", auditLogType, id, checkpointKey)
+}
+
+// KeyIncludesEvent reports whether keys contain the event name, in which case
+// every object must hold audit logs of a single event
+func (o Options) KeyIncludesEvent() bool {
+	tmpl, err := parseKeyTemplate(o.KeyTemplate, o.Partition)
+	return err == nil && tmpl.has(PlaceholderEvent)
+}
+
+// generateKey renders the key template for a batch starting with first, under
+// the key prefix
+// Default: {prefix}/workspace={workspaceID}/year={year}/month={month}/day={day}[/hour={hour}]/audit-logs-{timestamp}-{hash}{ext}
+//
+// The {batch} suffix is the first timestamp and a hash taken over the
+// uncompressed, marshaled batch, which includes every cursor and ID, so
+// re-uploading the same batch overwrites the same object while distinct
+// batches starting in the same second get distinct keys.
+func generateKey(tmpl *keyTemplate, opts Options, auditLogType auditlogs.LogType, id string, first render.AuditLog, ext string, content hash.Hash) string {
+	key := tmpl.render(keyFields{
+		auditLogType: string(auditLogType),
+		id:           id,
+		timestamp:    first.Timestamp,
+		event:        first.Event,
+		batch:        fmt.Sprintf("%s-%s", first.Timestamp.Format("2006-01-02_15-04-05"), contentHash(content)),
+		zeroPad:      opts.ZeroPadPartitions,
+	})
+
+	return normalizePrefix(opts.KeyPrefix) + key + ext
+}
+
+// contentHash returns a short, stable hex digest of the content written to h
+func contentHash(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,357 @@
+package archive_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/archive"
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+func decompress(t *testing.T, body []byte) []byte {
+	t.Helper()
+
+	gzReader, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	defer gzReader.Close()
+
+	decompressed, err := io.ReadAll(gzReader)
+	require.NoError(t, err)
+
+	return decompressed
+}
+
+func TestNewObject(t *testing.T) {
+	t.Parallel()
+
+	testData := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC))
+
+	t.Run("writes a JSON array by default", func(t *testing.T) {
+		t.Parallel()
+
+		obj, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, archive.Options{})
+		require.NoError(t, err)
+
+		require.Regexp(t, `^workspace=tea-123/year=2024/month=1/day=15/audit-logs-2024-01-15_10-30-00-[0-9a-f]{16}\.json\.gz$`, obj.Key)
+		require.Equal(t, "application/gzip", obj.ContentType)
+
+		// Streaming entries produces exactly what marshaling the batch would
+		expected, err := json.Marshal(testData)
+		require.NoError(t, err)
+		require.Equal(t, expected, decompress(t, obj.Body))
+	})
+
+	t.Run("writes one entry per line as NDJSON", func(t *testing.T) {
+		t.Parallel()
+
+		obj, err := archive.NewObject(auditlogs.OrganizationAuditLog, "org-456", testData, archive.Options{Format: archive.FormatNDJSON})
+		require.NoError(t, err)
+
+		require.Regexp(t, `^organization=org-456/year=2024/month=1/day=15/audit-logs-2024-01-15_10-30-00-[0-9a-f]{16}\.ndjson\.gz$`, obj.Key)
+		require.Equal(t, "application/gzip", obj.ContentType)
+
+		var entries []render.AuditLogEntry
+		scanner := bufio.NewScanner(bytes.NewReader(decompress(t, obj.Body)))
+		for scanner.Scan() {
+			var entry render.AuditLogEntry
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+			entries = append(entries, entry)
+		}
+		require.NoError(t, scanner.Err())
+		require.Equal(t, testData, entries)
+	})
+
+	t.Run("writes Parquet with a typed schema", func(t *testing.T) {
+		t.Parallel()
+
+		data := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC))
+		data[1].AuditLog.Metadata = map[string]string{"serviceId": "srv-123", "region": "oregon"}
+
+		obj, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", data, archive.Options{Format: archive.FormatParquet, ParquetCompression: "zstd"})
+		require.NoError(t, err)
+
+		require.Regexp(t, `^workspace=tea-123/year=2024/month=1/day=15/audit-logs-2024-01-15_10-30-00-[0-9a-f]{16}\.parquet$`, obj.Key)
+		require.Equal(t, "application/vnd.apache.parquet", obj.ContentType)
+
+		reader, err := file.NewParquetReader(bytes.NewReader(obj.Body))
+		require.NoError(t, err)
+		defer reader.Close()
+		chunk, err := reader.MetaData().RowGroup(0).ColumnChunk(0)
+		require.NoError(t, err)
+		require.Equal(t, compress.Codecs.Zstd, chunk.Compression())
+
+		fr, err := pqarrow.NewFileReader(reader, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+		require.NoError(t, err)
+		table, err := fr.ReadTable(context.Background())
+		require.NoError(t, err)
+		defer table.Release()
+
+		require.Equal(t, archive.ParquetSchema.NumFields(), table.Schema().NumFields())
+		for i, field := range archive.ParquetSchema.Fields() {
+			require.Equal(t, field.Name, table.Schema().Field(i).Name)
+			require.True(t, arrow.TypeEqual(field.Type, table.Schema().Field(i).Type), field.Name)
+		}
+		require.EqualValues(t, 3, table.NumRows())
+
+		column := func(i int) arrow.Array { return table.Column(i).Data().Chunk(0) }
+		ids := column(0).(*array.String)
+		timestamps := column(2).(*array.Timestamp)
+		actors := column(5).(*array.Struct)
+		metadata := column(6).(*array.Map)
+
+		for i, entry := range data {
+			require.Equal(t, entry.AuditLog.ID, ids.Value(i))
+			require.Equal(t, entry.Cursor, column(1).(*array.String).Value(i))
+			require.True(t, entry.AuditLog.Timestamp.Equal(timestamps.Value(i).ToTime(arrow.Microsecond)))
+			require.Equal(t, entry.AuditLog.Event, column(3).(*array.String).Value(i))
+			require.Equal(t, entry.AuditLog.Status, column(4).(*array.String).Value(i))
+			require.Equal(t, entry.AuditLog.Actor.Email, actors.Field(1).(*array.String).Value(i))
+		}
+
+		start, end := metadata.ValueOffsets(1)
+		require.EqualValues(t, 2, end-start)
+		keys := metadata.Keys().(*array.String)
+		items := metadata.Items().(*array.String)
+		require.Equal(t, "region", keys.Value(int(start)))
+		require.Equal(t, "oregon", items.Value(int(start)))
+		require.Equal(t, "serviceId", keys.Value(int(start)+1))
+		require.Equal(t, "srv-123", items.Value(int(start)+1))
+	})
+
+	t.Run("compresses with zstd", func(t *testing.T) {
+		t.Parallel()
+
+		obj, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, archive.Options{Compression: archive.CompressionZstd})
+		require.NoError(t, err)
+
+		require.True(t, strings.HasSuffix(obj.Key, ".json.zst"))
+		require.Equal(t, "application/zstd", obj.ContentType)
+		require.Empty(t, obj.ContentEncoding)
+
+		zr, err := zstd.NewReader(bytes.NewReader(obj.Body))
+		require.NoError(t, err)
+		defer zr.Close()
+
+		var entries []render.AuditLogEntry
+		require.NoError(t, json.NewDecoder(zr).Decode(&entries))
+		require.Equal(t, testData, entries)
+	})
+
+	t.Run("writes uncompressed objects with the format's content type", func(t *testing.T) {
+		t.Parallel()
+
+		obj, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, archive.Options{Format: archive.FormatNDJSON, Compression: archive.CompressionNone})
+		require.NoError(t, err)
+
+		require.True(t, strings.HasSuffix(obj.Key, ".ndjson"))
+		require.Equal(t, "application/x-ndjson", obj.ContentType)
+		require.Empty(t, obj.ContentEncoding)
+		require.Len(t, bytes.Split(bytes.TrimSuffix(obj.Body, []byte("\n")), []byte("\n")), 3)
+	})
+
+	t.Run("sets Content-Encoding when asked to", func(t *testing.T) {
+		t.Parallel()
+
+		obj, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, archive.Options{ContentEncoding: true})
+		require.NoError(t, err)
+
+		require.True(t, strings.HasSuffix(obj.Key, ".json.gz"))
+		require.Equal(t, "application/json", obj.ContentType)
+		require.Equal(t, "gzip", obj.ContentEncoding)
+	})
+
+	t.Run("uses the same key hash for every codec and level", func(t *testing.T) {
+		t.Parallel()
+
+		var keys []string
+		for _, opts := range []archive.Options{
+			{},
+			{GzipLevel: 1},
+			{GzipLevel: 9},
+			{Compression: archive.CompressionZstd},
+			{Compression: archive.CompressionNone},
+		} {
+			obj, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, opts)
+			require.NoError(t, err)
+			keys = append(keys, strings.TrimSuffix(strings.TrimSuffix(obj.Key, ".gz"), ".zst"))
+		}
+
+		for _, key := range keys {
+			require.Equal(t, keys[0], key)
+		}
+	})
+
+	t.Run("partitions by hour with zero padding and a prefix", func(t *testing.T) {
+		t.Parallel()
+
+		data := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 3, 5, 7, 30, 0, 0, time.UTC))
+
+		obj, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", data, archive.Options{
+			Partition:         archive.GranularityHour,
+			ZeroPadPartitions: true,
+			KeyPrefix:         "/render/audit/",
+		})
+		require.NoError(t, err)
+
+		require.Regexp(t, `^render/audit/workspace=tea-123/year=2024/month=03/day=05/hour=07/audit-logs-2024-03-05_07-30-00-[0-9a-f]{16}\.json\.gz$`, obj.Key)
+	})
+
+	t.Run("lays out keys with a template", func(t *testing.T) {
+		t.Parallel()
+
+		obj, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, archive.Options{
+			KeyPrefix:   "render",
+			KeyTemplate: "{type}/{id}/dt={date}/{event}/{year}{month}{day}-{batch}",
+		})
+		require.NoError(t, err)
+
+		require.Regexp(t, `^render/workspace/tea-123/dt=2024-01-15/LoginEvent/2024115-2024-01-15_10-30-00-[0-9a-f]{16}\.json\.gz$`, obj.Key)
+	})
+
+	t.Run("uses the same batch suffix in every layout", func(t *testing.T) {
+		t.Parallel()
+
+		obj, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, archive.Options{})
+		require.NoError(t, err)
+
+		templated, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, archive.Options{KeyTemplate: "{batch}"})
+		require.NoError(t, err)
+
+		require.True(t, strings.HasSuffix(obj.Key, "/audit-logs-"+templated.Key))
+	})
+
+	t.Run("returns error for a batch of mixed events keyed by event", func(t *testing.T) {
+		t.Parallel()
+
+		data := testhelpers.CreateTestAuditLogs(2, time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC))
+		data[1].AuditLog.Event = "ServiceCreated"
+
+		_, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", data, archive.Options{KeyTemplate: "{event}/{batch}"})
+		require.ErrorContains(t, err, "LoginEvent and ServiceCreated events")
+	})
+
+	t.Run("returns error for an unknown format", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, archive.Options{Format: "csv"})
+		require.ErrorContains(t, err, "unknown object format")
+
+		_, err = archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, archive.Options{Format: archive.FormatParquet, ParquetCompression: "brotli"})
+		require.ErrorContains(t, err, "unknown Parquet compression")
+
+		_, err = archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", testData, archive.Options{Compression: "brotli"})
+		require.ErrorContains(t, err, "unknown object compression")
+	})
+}
+
+func TestCheckpointKey(t *testing.T) {
+	require.Equal(t, "workspace=tea-123/checkpoint.json", archive.CheckpointKey(auditlogs.WorkspaceAuditLog, "tea-123"))
+	require.Equal(t, "organization=org-456/checkpoint.json", archive.CheckpointKey(auditlogs.OrganizationAuditLog, "org-456"))
+}
+
+func TestGranularityTruncate(t *testing.T) {
+	ts := time.Date(2024, 3, 5, 7, 30, 15, 0, time.UTC)
+
+	require.Equal(t, time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), archive.GranularityDay.Truncate(ts))
+	require.Equal(t, time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC), archive.GranularityHour.Truncate(ts))
+
+	// Partitions are in UTC whatever the timestamp's location
+	require.Equal(t, time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), archive.GranularityDay.Truncate(time.Date(2024, 3, 4, 20, 0, 0, 0, time.FixedZone("PST", -8*3600))))
+}
+
+func TestKeyTemplateValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		template  string
+		partition archive.Granularity
+		err       string
+	}{
+		{template: "{type}={id}/{batch}"},
+		{template: "{type}/{date}/{hour}/{batch}", partition: archive.GranularityHour},
+		{template: "{type}/{id}", err: "must contain {batch}"},
+		{template: "{type}/{region}/{batch}", err: "unknown placeholder {region}"},
+		{template: "{type}/{id/{batch}", err: "unknown placeholder {id/{batch}"},
+		{template: "{type}/{batch", err: "unclosed {"},
+		{template: "{type}}/{batch}", err: "unexpected }"},
+		{template: "/{type}/{batch}", err: "must not start with /"},
+		{template: "{hour}/{batch}", err: "{hour} requires hour partitions"},
+		{template: "{type}/../{batch}", err: "must not contain .. path segments"},
+		{template: "{type}/./{batch}", err: "must not contain . path segments"},
+		{template: "{type}//{batch}", err: "must not contain empty path segments"},
+		{template: "{batch}/", err: "must not contain empty path segments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			t.Parallel()
+
+			data := testhelpers.CreateTestAuditLogs(1, time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC))
+
+			_, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", data, archive.Options{KeyTemplate: tt.template, Partition: tt.partition})
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestKeyPrefixValidation(t *testing.T) {
+	t.Parallel()
+
+	data := testhelpers.CreateTestAuditLogs(1, time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC))
+
+	for _, prefix := range []string{"../render", "render/../..", "render//audit", "render/./audit"} {
+		_, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", data, archive.Options{KeyPrefix: prefix})
+		require.ErrorContains(t, err, "invalid key prefix", prefix)
+	}
+}
+
+func TestKeyEventSanitized(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		event   string
+		segment string
+	}{
+		{event: "LoginEvent", segment: "LoginEvent"},
+		{event: "../../etc", segment: ".._.._etc"},
+		{event: "..", segment: "__"},
+		{event: "", segment: "_"},
+		{event: `a\b c`, segment: "a_b_c"},
+	}
+
+	for _, tt := range tests {
+		data := testhelpers.CreateTestAuditLogs(1, time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC))
+		data[0].AuditLog.Event = tt.event
+
+		obj, err := archive.NewObject(auditlogs.WorkspaceAuditLog, "tea-123", data, archive.Options{KeyTemplate: "{event}/{batch}"})
+		require.NoError(t, err)
+		require.Equal(t, tt.segment, strings.Split(obj.Key, "/")[0], tt.event)
+	}
+}
+
+func TestKeyIncludesEvent(t *testing.T) {
+	require.False(t, archive.Options{}.KeyIncludesEvent())
+	require.True(t, archive.Options{KeyTemplate: "{event}/{batch}"}.KeyIncludesEvent())
+}
@@ -0,0 +1,88 @@
+package archive
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the codec JSON and NDJSON objects are compressed with
+type Compression string
+
+const (
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+	CompressionNone Compression = "none"
+)
+
+// ParseCompression validates a configured compression, defaulting to
+// CompressionGzip
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(s); c {
+	case "":
+		return CompressionGzip, nil
+	case CompressionGzip, CompressionZstd, CompressionNone:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unknown object compression %q, must be %s, %s or %s", s, CompressionGzip, CompressionZstd, CompressionNone)
+	}
+}
+
+// Extension is the file extension appended to the format's
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// ContentType is the media type of a compressed file, or empty when
+// uncompressed
+func (c Compression) ContentType() string {
+	switch c {
+	case CompressionGzip:
+		return "application/gzip"
+	case CompressionZstd:
+		return "application/zstd"
+	default:
+		return ""
+	}
+}
+
+// ContentEncoding is the HTTP content coding of the codec
+func (c Compression) ContentEncoding() string {
+	if c == CompressionNone {
+		return ""
+	}
+	return string(c)
+}
+
+// newWriter returns a writer that compresses to w. gzipLevel is only used by
+// gzip, where 0 selects the default level.
+func (c Compression) newWriter(w io.Writer, gzipLevel int) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		if gzipLevel == 0 {
+			gzipLevel = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, gzipLevel)
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
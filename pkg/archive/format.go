@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+// Format is the encoding of the audit logs in an object
+type Format string
+
+const (
+	// FormatJSON writes a batch as a single JSON array
+	FormatJSON Format = "json"
+	// FormatNDJSON writes one JSON audit log entry per line, which query
+	// engines and log shippers can split without parsing the whole object
+	FormatNDJSON Format = "ndjson"
+	// FormatParquet writes a batch as a Parquet file with ParquetSchema
+	FormatParquet Format = "parquet"
+)
+
+// ParseFormat validates a configured format, defaulting to FormatJSON
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatNDJSON, FormatParquet:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown object format %q, must be %s, %s or %s", s, FormatJSON, FormatNDJSON, FormatParquet)
+	}
+}
+
+// Extension is the file extension of the format, before any compression
+// extension
+func (f Format) Extension() string {
+	switch f {
+	case FormatNDJSON:
+		return ".ndjson"
+	case FormatParquet:
+		return ".parquet"
+	default:
+		return ".json"
+	}
+}
+
+// ContentType is the media type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "application/json"
+	}
+}
+
+// encode writes a batch of audit logs to w in one of the JSON formats, one
+// entry at a time so the batch is never held in memory as a whole. The JSON
+// format's output is identical to marshaling the slice.
+func (f Format) encode(w io.Writer, data []render.AuditLogEntry) error {
+	open, sep, end := "[", ",", "]"
+	if f == FormatNDJSON {
+		open, sep, end = "", "\n", "\n"
+	}
+
+	if _, err := io.WriteString(w, open); err != nil {
+		return err
+	}
+
+	for i, entry := range data {
+		if i > 0 {
+			if _, err := io.WriteString(w, sep); err != nil {
+				return err
+			}
+		}
+
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, end)
+	return err
+}
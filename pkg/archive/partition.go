@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Granularity is the time span of a key's partition
+type Granularity string
+
+const (
+	GranularityDay  Granularity = "day"
+	GranularityHour Granularity = "hour"
+)
+
+// ParseGranularity validates a configured partition granularity, defaulting
+// to GranularityDay
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case "":
+		return GranularityDay, nil
+	case GranularityDay, GranularityHour:
+		return g, nil
+	default:
+		return "", fmt.Errorf("unknown partition granularity %q, must be %s or %s", s, GranularityDay, GranularityHour)
+	}
+}
+
+// Truncate returns the start of the UTC partition t falls in. Audit logs are
+// only batched together when they share a partition, so every object's key
+// describes all of its contents.
+func (g Granularity) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	if g == GranularityHour {
+		return t.Truncate(time.Hour)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// validatePrefix rejects a key prefix with empty, . or .. segments. Leading
+// and trailing slashes are allowed, since normalizePrefix strips them.
+func validatePrefix(prefix string) error {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return nil
+	}
+	if err := checkSegments(prefix); err != nil {
+		return fmt.Errorf("invalid key prefix %q: %w", prefix, err)
+	}
+	return nil
+}
+
+// normalizePrefix strips surrounding slashes from a key prefix and terminates
+// it with one, so it can be prepended to keys as is
+func normalizePrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
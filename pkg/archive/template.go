@@ -0,0 +1,196 @@
+package archive
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Key template placeholders
+const (
+	PlaceholderType  = "type"
+	PlaceholderID    = "id"
+	PlaceholderYear  = "year"
+	PlaceholderMonth = "month"
+	PlaceholderDay   = "day"
+	PlaceholderHour  = "hour"
+	PlaceholderDate  = "date"
+	PlaceholderEvent = "event"
+	PlaceholderBatch = "batch"
+)
+
+var placeholders = []string{
+	PlaceholderType,
+	PlaceholderID,
+	PlaceholderYear,
+	PlaceholderMonth,
+	PlaceholderDay,
+	PlaceholderHour,
+	PlaceholderDate,
+	PlaceholderEvent,
+	PlaceholderBatch,
+}
+
+// keyTemplate is a parsed key template, a sequence of literal text and
+// placeholders
+type keyTemplate struct {
+	segments []templateSegment
+}
+
+type templateSegment struct {
+	literal     string
+	placeholder string
+}
+
+// keyFields are the values substituted into a key template
+type keyFields struct {
+	auditLogType string
+	id           string
+	timestamp    time.Time
+	event        string
+	batch        string
+	zeroPad      bool
+}
+
+// defaultKeyTemplate is the Hive-style layout used when no template is
+// configured
+func defaultKeyTemplate(g Granularity) string {
+	template := "{type}={id}/year={year}/month={month}/day={day}"
+	if g == GranularityHour {
+		template += "/hour={hour}"
+	}
+	return template + "/audit-logs-{batch}"
+}
+
+// parseKeyTemplate validates a key template against the partition
+// granularity. Every template needs {batch} so distinct batches never
+// overwrite each other, and {hour} needs hourly partitions so that every
+// entry in an object shares the hour in its key.
+func parseKeyTemplate(s string, g Granularity) (*keyTemplate, error) {
+	if s == "" {
+		s = defaultKeyTemplate(g)
+	}
+
+	t := &keyTemplate{}
+	rest := s
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open < 0 {
+			t.segments = append(t.segments, templateSegment{literal: rest})
+			break
+		}
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("invalid key template %q: unexpected }", s)
+		}
+		if open > 0 {
+			t.segments = append(t.segments, templateSegment{literal: rest[:open]})
+		}
+
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid key template %q: unclosed {", s)
+		}
+		name := rest[open+1 : open+end]
+		if !slices.Contains(placeholders, name) {
+			return nil, fmt.Errorf("invalid key template %q: unknown placeholder {%s}, must be one of {%s}", s, name, strings.Join(placeholders, "}, {"))
+		}
+		t.segments = append(t.segments, templateSegment{placeholder: name})
+		rest = rest[open+end+1:]
+	}
+
+	if strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid key template %q: must not start with /, use OBJECT_KEY_PREFIX for a prefix", s)
+	}
+	if err := checkSegments(s); err != nil {
+		return nil, fmt.Errorf("invalid key template %q: %w", s, err)
+	}
+	if !t.has(PlaceholderBatch) {
+		return nil, fmt.Errorf("invalid key template %q: must contain {%s}", s, PlaceholderBatch)
+	}
+	if t.has(PlaceholderHour) && g != GranularityHour {
+		return nil, fmt.Errorf("invalid key template %q: {%s} requires %s partitions", s, PlaceholderHour, GranularityHour)
+	}
+
+	return t, nil
+}
+
+func (t *keyTemplate) has(placeholder string) bool {
+	return slices.ContainsFunc(t.segments, func(seg templateSegment) bool {
+		return seg.placeholder == placeholder
+	})
+}
+
+// render substitutes fields into the template. Month, day and hour follow the
+// zero padding setting, while {date} is always YYYY-MM-DD. Event names come
+// from the API, so they are sanitized to stay within their path segment.
+func (t *keyTemplate) render(f keyFields) string {
+	ts := f.timestamp.UTC()
+
+	number := func(n int) string {
+		if f.zeroPad {
+			return fmt.Sprintf("%02d", n)
+		}
+		return fmt.Sprintf("%d", n)
+	}
+
+	var b strings.Builder
+	for _, seg := range t.segments {
+		switch seg.placeholder {
+		case "":
+			b.WriteString(seg.literal)
+		case PlaceholderType:
+			b.WriteString(f.auditLogType)
+		case PlaceholderID:
+			b.WriteString(f.id)
+		case PlaceholderYear:
+			fmt.Fprintf(&b, "%04d", ts.Year())
+		case PlaceholderMonth:
+			b.WriteString(number(int(ts.Month())))
+		case PlaceholderDay:
+			b.WriteString(number(ts.Day()))
+		case PlaceholderHour:
+			b.WriteString(number(ts.Hour()))
+		case PlaceholderDate:
+			b.WriteString(ts.Format(time.DateOnly))
+		case PlaceholderEvent:
+			b.WriteString(sanitizeSegment(f.event))
+		case PlaceholderBatch:
+			b.WriteString(f.batch)
+		}
+	}
+
+	return b.String()
+}
+
+// checkSegments rejects empty, . and .. segments in a slash-separated path, so
+// keys can't escape their prefix or a filesystem sink's root
+func checkSegments(path string) error {
+	for _, segment := range strings.Split(path, "/") {
+		switch segment {
+		case "":
+			return fmt.Errorf("must not contain empty path segments")
+		case ".", "..":
+			return fmt.Errorf("must not contain %s path segments", segment)
+		}
+	}
+	return nil
+}
+
+// sanitizeSegment replaces everything but letters, digits, -, _ and . with _,
+// and a value of only dots with underscores, so it is a single safe segment
+func sanitizeSegment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+
+	if strings.Trim(s, ".") == "" {
+		return strings.Repeat("_", max(len(s), 1))
+	}
+	return s
+}
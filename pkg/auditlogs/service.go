@@ -1,6 +1,7 @@
 package auditlogs
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/renderinc/render-auditlogs/pkg/render"
@@ -16,7 +17,7 @@ const (
 )
 
 type Service interface {
-	Get(id string, cursor string, limit int) ([]render.AuditLogEntry, error)
+	Get(ctx context.Context, id string, cursor string, limit int) ([]render.AuditLogEntry, error)
 	Type() LogType
 }
 
@@ -29,13 +30,13 @@ type WorkspaceSvc struct {
 }
 
 type RenderClient interface {
-	GetAuditLogs(endpoint string, cursor string, limit int) ([]render.AuditLogEntry, error)
+	GetAuditLogs(ctx context.Context, endpoint string, cursor string, limit int) ([]render.AuditLogEntry, error)
 }
 
-func (w *WorkspaceSvc) Get(id string, cursor string, limit int) ([]render.AuditLogEntry, error) {
+func (w *WorkspaceSvc) Get(ctx context.Context, id string, cursor string, limit int) ([]render.AuditLogEntry, error) {
 	endpoint := fmt.Sprintf("/owners/%s%s", id, auditLogsEndpoint)
 
-	return w.client.GetAuditLogs(endpoint, cursor, limit)
+	return w.client.GetAuditLogs(ctx, endpoint, cursor, limit)
 }
 
 func (w *WorkspaceSvc) Type() LogType {
@@ -50,10 +51,10 @@ type OrganizationSvc struct {
 	client RenderClient
 }
 
-func (o *OrganizationSvc) Get(id string, cursor string, limit int) ([]render.AuditLogEntry, error) {
+func (o *OrganizationSvc) Get(ctx context.Context, id string, cursor string, limit int) ([]render.AuditLogEntry, error) {
 	endpoint := fmt.Sprintf("/organizations/%s%s", id, auditLogsEndpoint)
 
-	return o.client.GetAuditLogs(endpoint, cursor, limit)
+	return o.client.GetAuditLogs(ctx, endpoint, cursor, limit)
 }
 
 func (o *OrganizationSvc) Type() LogType {
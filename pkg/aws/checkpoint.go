@@ -7,28 +7,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
+	"github.com/renderinc/render-auditlogs/pkg/archive"
 	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
 )
 
-// Checkpoint represents the state to persist between runs
-type Checkpoint struct {
-	LastCursor    string    `json:"lastCursor"`
-	LastTimestamp time.Time `json:"lastTimestamp"`
-}
-
-const checkpointKey = "checkpoint.json"
-
 // LoadCheckpoint reads the checkpoint from S3. Returns nil if file doesn't exist.
-func (u *Uploader) LoadCheckpoint(ctx context.Context, logType auditlogs.LogType, workspace string) (*Checkpoint, error) {
+func (u *Uploader) LoadCheckpoint(ctx context.Context, logType auditlogs.LogType, workspace string) (*checkpoint.Checkpoint, error) {
 	result, err := u.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(u.bucket),
-		Key:    aws.String(fmt.Sprintf("%s=%s/%s", logType, workspace, checkpointKey)),
+		Key:    aws.String(archive.CheckpointKey(logType, workspace)),
 	})
 	if err != nil {
 		var nsk *types.NoSuchKey
@@ -45,7 +38,7 @@ func (u *Uploader) LoadCheckpoint(ctx context.Context, logType auditlogs.LogType
 		return nil, fmt.Errorf("error reading checkpoint body: %w", err)
 	}
 
-	var cp Checkpoint
+	var cp checkpoint.Checkpoint
 	if err := json.Unmarshal(data, &cp); err != nil {
 		return nil, fmt.Errorf("error unmarshaling checkpoint: %w", err)
 	}
@@ -54,7 +47,7 @@ func (u *Uploader) LoadCheckpoint(ctx context.Context, logType auditlogs.LogType
 }
 
 // SaveCheckpoint writes the checkpoint to S3
-func (u *Uploader) SaveCheckpoint(ctx context.Context, cp *Checkpoint, logType auditlogs.LogType, workspace string) error {
+func (u *Uploader) SaveCheckpoint(ctx context.Context, cp *checkpoint.Checkpoint, logType auditlogs.LogType, workspace string) error {
 	data, err := json.MarshalIndent(cp, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshaling checkpoint: %w", err)
@@ -62,23 +55,12 @@ func (u *Uploader) SaveCheckpoint(ctx context.Context, cp *Checkpoint, logType a
 
 	putInput := &s3.PutObjectInput{
 		Bucket:      aws.String(u.bucket),
-		Key:         aws.String(fmt.Sprintf("%s=%s/%s", logType, workspace, checkpointKey)),
+		Key:         aws.String(archive.CheckpointKey(logType, workspace)),
 		Body:        bytes.NewReader(data),
 		ContentType: aws.String("application/json"),
 	}
 
-	// Configure server-side encryption
-	if u.opts.UseKMS {
-		putInput.ServerSideEncryption = types.ServerSideEncryptionAwsKms
-		if u.opts.KMSKeyID != "" {
-			putInput.SSEKMSKeyId = aws.String(u.opts.KMSKeyID)
-		}
-		if u.opts.BucketKeyEnabled {
-			putInput.BucketKeyEnabled = aws.Bool(true)
-		}
-	} else {
-		putInput.ServerSideEncryption = types.ServerSideEncryptionAes256
-	}
+	u.configureEncryption(putInput)
 
 	_, err = u.client.PutObject(ctx, putInput)
 	if err != nil {
@@ -16,6 +16,7 @@ import (
 
 	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
 	awspkg "github.com/renderinc/render-auditlogs/pkg/aws"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
 )
 
 type mockS3Client struct {
@@ -36,11 +37,11 @@ func TestLoadCheckpoint(t *testing.T) {
 	testTime := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
 
 	t.Run("successfully loads checkpoint", func(t *testing.T) {
-		checkpoint := awspkg.Checkpoint{
+		want := checkpoint.Checkpoint{
 			LastCursor:    "test-cursor-123",
 			LastTimestamp: testTime,
 		}
-		checkpointJSON, err := json.Marshal(checkpoint)
+		checkpointJSON, err := json.Marshal(want)
 		require.NoError(t, err)
 
 		s3Client := &mockS3Client{
@@ -125,7 +126,7 @@ func TestSaveCheckpoint(t *testing.T) {
 	testTime := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
 
 	t.Run("successfully saves checkpoint", func(t *testing.T) {
-		checkpoint := &awspkg.Checkpoint{
+		want := &checkpoint.Checkpoint{
 			LastCursor:    "test-cursor-456",
 			LastTimestamp: testTime,
 		}
@@ -140,11 +141,11 @@ func TestSaveCheckpoint(t *testing.T) {
 				bodyBytes, err := io.ReadAll(params.Body)
 				require.NoError(t, err)
 
-				var savedCP awspkg.Checkpoint
+				var savedCP checkpoint.Checkpoint
 				err = json.Unmarshal(bodyBytes, &savedCP)
 				require.NoError(t, err)
-				require.Equal(t, checkpoint.LastCursor, savedCP.LastCursor)
-				require.Equal(t, checkpoint.LastTimestamp, savedCP.LastTimestamp)
+				require.Equal(t, want.LastCursor, savedCP.LastCursor)
+				require.Equal(t, want.LastTimestamp, savedCP.LastTimestamp)
 
 				return &s3.PutObjectOutput{}, nil
 			},
@@ -153,13 +154,13 @@ func TestSaveCheckpoint(t *testing.T) {
 		uploader, err := awspkg.NewUploader(ctx, s3Client, "test-bucket", "test-region")
 		require.NoError(t, err)
 
-		err = uploader.SaveCheckpoint(ctx, checkpoint, auditlogs.WorkspaceAuditLog, "test-workspace")
+		err = uploader.SaveCheckpoint(ctx, want, auditlogs.WorkspaceAuditLog, "test-workspace")
 
 		require.NoError(t, err)
 	})
 
 	t.Run("uses KMS with key ID and bucket key enabled", func(t *testing.T) {
-		checkpoint := &awspkg.Checkpoint{
+		want := &checkpoint.Checkpoint{
 			LastCursor:    "kms-cursor",
 			LastTimestamp: testTime,
 		}
@@ -186,12 +187,12 @@ func TestSaveCheckpoint(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		err = uploader.SaveCheckpoint(ctx, checkpoint, auditlogs.WorkspaceAuditLog, "test-workspace")
+		err = uploader.SaveCheckpoint(ctx, want, auditlogs.WorkspaceAuditLog, "test-workspace")
 		require.NoError(t, err)
 	})
 
 	t.Run("returns error on S3 error", func(t *testing.T) {
-		checkpoint := &awspkg.Checkpoint{
+		want := &checkpoint.Checkpoint{
 			LastCursor:    "test-cursor",
 			LastTimestamp: testTime,
 		}
@@ -205,7 +206,7 @@ func TestSaveCheckpoint(t *testing.T) {
 		uploader, err := awspkg.NewUploader(ctx, s3Client, "test-bucket", "test-region")
 		require.NoError(t, err)
 
-		err = uploader.SaveCheckpoint(ctx, checkpoint, auditlogs.WorkspaceAuditLog, "test-workspace")
+		err = uploader.SaveCheckpoint(ctx, want, auditlogs.WorkspaceAuditLog, "test-workspace")
 
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "error writing checkpoint to S3")
@@ -0,0 +1,283 @@
+package aws
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/logger"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+// Limits of PutLogEvents
+// https://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutLogEvents.html
+const (
+	maxEventsPerBatch = 10000
+	maxBatchBytes     = 1048576
+	// eventOverheadBytes is added to the size of every message
+	eventOverheadBytes = 26
+	maxEventBytes      = 1048576 - eventOverheadBytes
+	maxBatchSpan       = 24 * time.Hour
+	// maxEventAge is how old an event can be, unless the log group's
+	// retention is shorter
+	maxEventAge = 14 * 24 * time.Hour
+)
+
+type CloudWatchLogsClient interface {
+	CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error)
+	DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
+	CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error)
+	PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error)
+}
+
+type CloudWatchSinkOptions struct {
+	// CreateLogGroup creates the log group if it doesn't exist
+	CreateLogGroup bool
+}
+
+// CloudWatchSink writes audit logs to a CloudWatch Logs group, with a log
+// stream per workspace or organization
+type CloudWatchSink struct {
+	client   CloudWatchLogsClient
+	logGroup string
+	opts     CloudWatchSinkOptions
+
+	// streams holds the log streams known to exist
+	streams sync.Map
+	// groupMu guards groupCreated, which is only set once the log group is
+	// known to exist so that a failed attempt is retried by the next upload
+	groupMu      sync.Mutex
+	groupCreated bool
+	// retentionMu guards maxAge, the age of the oldest event the log group
+	// accepts, which is looked up by the first upload
+	retentionMu sync.Mutex
+	maxAge      time.Duration
+}
+
+// cloudWatchEvent is the message of each log event
+type cloudWatchEvent struct {
+	LogType  string          `json:"log_type"`
+	OwnerID  string          `json:"owner_id"`
+	Cursor   string          `json:"cursor"`
+	AuditLog render.AuditLog `json:"auditLog"`
+}
+
+func NewCloudWatchSinkFromConfig(ctx context.Context, cfg *env.Config) (*CloudWatchSink, error) {
+	if cfg.CloudWatchLogGroup == "" || cfg.AWSRegion == "" {
+		return nil, fmt.Errorf("CLOUDWATCH_LOG_GROUP and AWS_REGION are required for the cloudwatch sink")
+	}
+
+	client := cloudwatchlogs.NewFromConfig(cfg.AWSConfig)
+
+	return NewCloudWatchSink(client, cfg.CloudWatchLogGroup, CloudWatchSinkOptions{
+		CreateLogGroup: cfg.CloudWatchCreateLogGroup,
+	}), nil
+}
+
+func NewCloudWatchSink(client CloudWatchLogsClient, logGroup string, opts CloudWatchSinkOptions) *CloudWatchSink {
+	return &CloudWatchSink{
+		client:   client,
+		logGroup: logGroup,
+		opts:     opts,
+	}
+}
+
+// UploadAuditLogs writes audit logs to the owner's log stream in chronological
+// order, split into as many PutLogEvents calls as needed to stay within the
+// per-call limits. Audit logs older than the log group accepts are dropped.
+func (c *CloudWatchSink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	stream := fmt.Sprintf("%s-%s", auditLogType, id)
+
+	if err := c.ensureLogStream(ctx, stream); err != nil {
+		return "", err
+	}
+
+	maxAge, err := c.maxEventAge(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// CloudWatch Logs rejects events older than it accepts on every attempt,
+	// so they are dropped rather than failing the upload for good
+	cutoff := time.Now().Add(-maxAge)
+	events := make([]types.InputLogEvent, 0, len(data))
+	dropped := 0
+	for _, entry := range data {
+		if entry.AuditLog.Timestamp.Before(cutoff) {
+			dropped++
+			continue
+		}
+
+		message, err := json.Marshal(cloudWatchEvent{
+			LogType:  string(auditLogType),
+			OwnerID:  id,
+			Cursor:   entry.Cursor,
+			AuditLog: entry.AuditLog,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error marshaling log event: %w", err)
+		}
+		if len(message) > maxEventBytes {
+			return "", fmt.Errorf("audit log %s is %d bytes, more than CloudWatch Logs' limit of %d", entry.AuditLog.ID, len(message), maxEventBytes)
+		}
+
+		events = append(events, types.InputLogEvent{
+			Message:   aws.String(string(message)),
+			Timestamp: aws.Int64(entry.AuditLog.Timestamp.UnixMilli()),
+		})
+	}
+
+	if dropped > 0 {
+		logger.FromContext(ctx).Warn("dropping audit logs older than CloudWatch Logs accepts", "stream", stream, "count", dropped, "max_age", maxAge)
+	}
+
+	// PutLogEvents rejects batches that aren't in chronological order
+	slices.SortStableFunc(events, func(a, b types.InputLogEvent) int {
+		return cmp.Compare(*a.Timestamp, *b.Timestamp)
+	})
+
+	for _, batch := range batchLogEvents(events) {
+		if err := c.putLogEvents(ctx, stream, batch); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("cloudwatch://%s/%s", c.logGroup, stream), nil
+}
+
+func (c *CloudWatchSink) putLogEvents(ctx context.Context, stream string, batch []types.InputLogEvent) error {
+	out, err := c.client.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(c.logGroup),
+		LogStreamName: aws.String(stream),
+		LogEvents:     batch,
+	})
+	if err != nil {
+		return fmt.Errorf("error putting log events to CloudWatch Logs: %w", err)
+	}
+
+	// Events too far in the future may be accepted by a later attempt, so the
+	// batch fails. Events that expired since the cutoff was computed never
+	// will be, so they are only logged.
+	if rejected := out.RejectedLogEventsInfo; rejected != nil {
+		if rejected.TooNewLogEventStartIndex != nil {
+			return fmt.Errorf("CloudWatch Logs rejected log events in stream %s newer than it accepts from index %d", stream, *rejected.TooNewLogEventStartIndex)
+		}
+		if old := max(aws.ToInt32(rejected.TooOldLogEventEndIndex), aws.ToInt32(rejected.ExpiredLogEventEndIndex)); old > 0 {
+			logger.FromContext(ctx).Warn("CloudWatch Logs rejected audit logs older than it accepts", "stream", stream, "count", old)
+		}
+	}
+
+	return nil
+}
+
+// batchLogEvents splits chronologically sorted events into batches within the
+// count, size and time span limits of PutLogEvents
+func batchLogEvents(events []types.InputLogEvent) [][]types.InputLogEvent {
+	var batches [][]types.InputLogEvent
+	start, size := 0, 0
+
+	for i, event := range events {
+		eventSize := len(*event.Message) + eventOverheadBytes
+		span := time.Duration(*event.Timestamp-*events[start].Timestamp) * time.Millisecond
+
+		if i > start && (i-start == maxEventsPerBatch || size+eventSize > maxBatchBytes || span >= maxBatchSpan) {
+			batches = append(batches, events[start:i])
+			start, size = i, 0
+		}
+		size += eventSize
+	}
+
+	if start < len(events) {
+		batches = append(batches, events[start:])
+	}
+
+	return batches
+}
+
+// ensureLogStream creates the log stream, and the log group if configured to,
+// unless it is already known to exist
+func (c *CloudWatchSink) ensureLogStream(ctx context.Context, stream string) error {
+	if _, ok := c.streams.Load(stream); ok {
+		return nil
+	}
+
+	if c.opts.CreateLogGroup {
+		if err := c.ensureLogGroup(ctx); err != nil {
+			return err
+		}
+	}
+
+	_, err := c.client.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(c.logGroup),
+		LogStreamName: aws.String(stream),
+	})
+	var exists *types.ResourceAlreadyExistsException
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("error creating CloudWatch Logs stream: %w", err)
+	}
+
+	c.streams.Store(stream, struct{}{})
+	return nil
+}
+
+// ensureLogGroup creates the log group unless it is already known to exist
+func (c *CloudWatchSink) ensureLogGroup(ctx context.Context) error {
+	c.groupMu.Lock()
+	defer c.groupMu.Unlock()
+
+	if c.groupCreated {
+		return nil
+	}
+
+	_, err := c.client.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{
+		LogGroupName: aws.String(c.logGroup),
+	})
+	var exists *types.ResourceAlreadyExistsException
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("error creating CloudWatch Logs group: %w", err)
+	}
+
+	c.groupCreated = true
+	return nil
+}
+
+// maxEventAge returns the age of the oldest event the log group accepts, 14
+// days or its retention if that is shorter
+func (c *CloudWatchSink) maxEventAge(ctx context.Context) (time.Duration, error) {
+	c.retentionMu.Lock()
+	defer c.retentionMu.Unlock()
+
+	if c.maxAge > 0 {
+		return c.maxAge, nil
+	}
+
+	out, err := c.client.DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupIdentifiers: []string{c.logGroup},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error describing CloudWatch Logs group: %w", err)
+	}
+
+	c.maxAge = maxEventAge
+	for _, group := range out.LogGroups {
+		if aws.ToString(group.LogGroupName) != c.logGroup {
+			continue
+		}
+		if days := aws.ToInt32(group.RetentionInDays); days > 0 {
+			c.maxAge = min(c.maxAge, time.Duration(days)*24*time.Hour)
+		}
+	}
+
+	return c.maxAge, nil
+}
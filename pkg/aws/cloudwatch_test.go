@@ -0,0 +1,322 @@
+package aws_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/aws"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+// mockCloudWatchLogsClient records log groups, streams and the batches put to
+// them, enforcing the ordering and limits of PutLogEvents
+type mockCloudWatchLogsClient struct {
+	mu sync.Mutex
+
+	groups  map[string]bool
+	streams map[string]bool
+	// retention is the retention in days of each log group that has one
+	retention map[string]int32
+	batches   [][]types.InputLogEvent
+
+	createStreamCalls int
+
+	// createGroupErrs are returned by the first calls to CreateLogGroup
+	createGroupErrs []error
+	// rejected is returned with every accepted batch
+	rejected *types.RejectedLogEventsInfo
+}
+
+func newMockCloudWatchLogsClient(groups ...string) *mockCloudWatchLogsClient {
+	m := &mockCloudWatchLogsClient{groups: map[string]bool{}, streams: map[string]bool{}, retention: map[string]int32{}}
+	for _, g := range groups {
+		m.groups[g] = true
+	}
+	return m
+}
+
+func (m *mockCloudWatchLogsClient) CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.createGroupErrs) > 0 {
+		err := m.createGroupErrs[0]
+		m.createGroupErrs = m.createGroupErrs[1:]
+		return nil, err
+	}
+	if m.groups[*params.LogGroupName] {
+		return nil, &types.ResourceAlreadyExistsException{}
+	}
+	m.groups[*params.LogGroupName] = true
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (m *mockCloudWatchLogsClient) DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := &cloudwatchlogs.DescribeLogGroupsOutput{}
+	for _, name := range params.LogGroupIdentifiers {
+		if !m.groups[name] {
+			continue
+		}
+		group := types.LogGroup{LogGroupName: awssdk.String(name)}
+		if days, ok := m.retention[name]; ok {
+			group.RetentionInDays = awssdk.Int32(days)
+		}
+		out.LogGroups = append(out.LogGroups, group)
+	}
+	return out, nil
+}
+
+func (m *mockCloudWatchLogsClient) CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.createStreamCalls++
+	if !m.groups[*params.LogGroupName] {
+		return nil, &types.ResourceNotFoundException{}
+	}
+
+	key := *params.LogGroupName + "/" + *params.LogStreamName
+	if m.streams[key] {
+		return nil, &types.ResourceAlreadyExistsException{}
+	}
+	m.streams[key] = true
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (m *mockCloudWatchLogsClient) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.streams[*params.LogGroupName+"/"+*params.LogStreamName] {
+		return nil, &types.ResourceNotFoundException{}
+	}
+	if len(params.LogEvents) > 10000 {
+		return nil, &types.InvalidParameterException{Message: awssdk.String("too many events")}
+	}
+
+	size := 0
+	for i, e := range params.LogEvents {
+		size += len(*e.Message) + 26
+		if i > 0 && *e.Timestamp < *params.LogEvents[i-1].Timestamp {
+			return nil, &types.InvalidParameterException{Message: awssdk.String("events are not in chronological order")}
+		}
+	}
+	if size > 1048576 {
+		return nil, &types.InvalidParameterException{Message: awssdk.String("batch too large")}
+	}
+	first, last := *params.LogEvents[0].Timestamp, *params.LogEvents[len(params.LogEvents)-1].Timestamp
+	if time.Duration(last-first)*time.Millisecond >= 24*time.Hour {
+		return nil, &types.InvalidParameterException{Message: awssdk.String("batch spans more than 24 hours")}
+	}
+
+	m.batches = append(m.batches, params.LogEvents)
+	return &cloudwatchlogs.PutLogEventsOutput{RejectedLogEventsInfo: m.rejected}, nil
+}
+
+func TestCloudWatchUploadAuditLogs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	// CloudWatch Logs only accepts events from the last 14 days
+	testDate := time.Now().UTC().Add(-10 * 24 * time.Hour).Truncate(time.Hour)
+
+	t.Run("writes events in chronological order to the owner's stream", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient("/render/audit-logs")
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{})
+
+		// The Render API returns the newest audit logs first
+		testData := testhelpers.CreateTestAuditLogs(3, testDate)
+		testData[0], testData[2] = testData[2], testData[0]
+
+		location, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+		require.Equal(t, "cloudwatch:///render/audit-logs/workspace-tea-123", location)
+		require.True(t, client.streams["/render/audit-logs/workspace-tea-123"])
+
+		require.Len(t, client.batches, 1)
+		batch := client.batches[0]
+		require.Len(t, batch, 3)
+
+		for i, e := range batch {
+			var event struct {
+				LogType  string `json:"log_type"`
+				OwnerID  string `json:"owner_id"`
+				AuditLog struct {
+					ID string `json:"id"`
+				} `json:"auditLog"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(*e.Message), &event))
+			require.Equal(t, "workspace", event.LogType)
+			require.Equal(t, "tea-123", event.OwnerID)
+			require.Equal(t, testData[2-i].AuditLog.ID, event.AuditLog.ID)
+			require.Equal(t, testData[2-i].AuditLog.Timestamp.UnixMilli(), *e.Timestamp)
+		}
+	})
+
+	t.Run("creates the stream only once", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient("/render/audit-logs")
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{})
+
+		for range 3 {
+			_, err := sink.UploadAuditLogs(ctx, auditlogs.OrganizationAuditLog, "org-456", testhelpers.CreateTestAuditLogs(2, testDate))
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, 1, client.createStreamCalls)
+		require.Len(t, client.batches, 3)
+	})
+
+	t.Run("uses an existing stream", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient("/render/audit-logs")
+		client.streams["/render/audit-logs/workspace-tea-123"] = true
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{})
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(2, testDate))
+		require.NoError(t, err)
+		require.Len(t, client.batches, 1)
+	})
+
+	t.Run("creates the log group when configured to", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient()
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{CreateLogGroup: true})
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(2, testDate))
+		require.NoError(t, err)
+		require.True(t, client.groups["/render/audit-logs"])
+	})
+
+	t.Run("retries creating the log group after a failure", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient()
+		client.createGroupErrs = []error{&types.ServiceUnavailableException{}}
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{CreateLogGroup: true})
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(2, testDate))
+		require.ErrorContains(t, err, "error creating CloudWatch Logs group")
+
+		_, err = sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(2, testDate))
+		require.NoError(t, err)
+		require.True(t, client.groups["/render/audit-logs"])
+	})
+
+	t.Run("drops events older than 14 days", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient("/render/audit-logs")
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{})
+
+		testData := append(
+			testhelpers.CreateTestAuditLogs(3, time.Now().Add(-20*24*time.Hour)),
+			testhelpers.CreateTestAuditLogs(2, testDate)...,
+		)
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+		require.Len(t, client.batches, 1)
+		require.Len(t, client.batches[0], 2)
+		require.Equal(t, testData[3].AuditLog.Timestamp.UnixMilli(), *client.batches[0][0].Timestamp)
+	})
+
+	t.Run("drops events older than the log group's retention", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient("/render/audit-logs")
+		client.retention["/render/audit-logs"] = 7
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{})
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(2, testDate))
+		require.NoError(t, err)
+		require.Empty(t, client.batches)
+
+		_, err = sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(2, time.Now().Add(-24*time.Hour)))
+		require.NoError(t, err)
+		require.Len(t, client.batches, 1)
+	})
+
+	t.Run("ignores events rejected as too old", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient("/render/audit-logs")
+		client.rejected = &types.RejectedLogEventsInfo{TooOldLogEventEndIndex: awssdk.Int32(1)}
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{})
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(2, testDate))
+		require.NoError(t, err)
+	})
+
+	t.Run("returns error when events are rejected as too new", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient("/render/audit-logs")
+		client.rejected = &types.RejectedLogEventsInfo{TooNewLogEventStartIndex: awssdk.Int32(1)}
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{})
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(2, testDate))
+		require.ErrorContains(t, err, "newer than it accepts from index 1")
+	})
+
+	t.Run("returns error when the log group doesn't exist", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient()
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{})
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(2, testDate))
+		var notFound *types.ResourceNotFoundException
+		require.True(t, errors.As(err, &notFound))
+	})
+
+	t.Run("splits batches at the per-call limits", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient("/render/audit-logs")
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{})
+
+		// Three events are large enough to exceed the batch size limit
+		// together
+		testData := testhelpers.CreateTestAuditLogs(10005, testDate)
+		for i := range 3 {
+			testData[i].AuditLog.Metadata = map[string]string{"large": strings.Repeat("x", 400*1024)}
+		}
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+
+		total := 0
+		for _, batch := range client.batches {
+			total += len(batch)
+		}
+		require.Equal(t, 10005, total)
+		require.Greater(t, len(client.batches), 2)
+		require.Len(t, client.batches[0], 2)
+	})
+
+	t.Run("splits batches spanning more than 24 hours", func(t *testing.T) {
+		t.Parallel()
+		client := newMockCloudWatchLogsClient("/render/audit-logs")
+		sink := aws.NewCloudWatchSink(client, "/render/audit-logs", aws.CloudWatchSinkOptions{})
+
+		testData := append(
+			testhelpers.CreateTestAuditLogs(2, testDate),
+			testhelpers.CreateTestAuditLogs(2, testDate.Add(30*time.Hour))...,
+		)
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+		require.Len(t, client.batches, 2)
+		require.Len(t, client.batches[0], 2)
+		require.Len(t, client.batches[1], 2)
+	})
+}
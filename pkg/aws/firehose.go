@@ -0,0 +1,179 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	firehosetypes "github.com/aws/aws-sdk-go-v2/service/firehose/types"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/logger"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+// Limits of PutRecordBatch
+// https://docs.aws.amazon.com/firehose/latest/APIReference/API_PutRecordBatch.html
+const (
+	firehoseMaxRecordsPerBatch = 500
+	firehoseMaxBatchBytes      = 4 * 1024 * 1024
+	firehoseMaxRecordBytes     = 1000 * 1024
+)
+
+type FirehoseClient interface {
+	PutRecordBatch(ctx context.Context, params *firehose.PutRecordBatchInput, optFns ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error)
+}
+
+// FirehoseSink sends audit logs to an Amazon Data Firehose stream as
+// newline-delimited JSON records
+type FirehoseSink struct {
+	client         FirehoseClient
+	deliveryStream string
+	retry          retry.Policy
+}
+
+// streamRecord is the JSON of each record sent to Firehose or Kinesis
+type streamRecord struct {
+	LogType  string          `json:"log_type"`
+	OwnerID  string          `json:"owner_id"`
+	Cursor   string          `json:"cursor"`
+	AuditLog render.AuditLog `json:"auditLog"`
+}
+
+func NewFirehoseSinkFromConfig(ctx context.Context, cfg *env.Config) (*FirehoseSink, error) {
+	if cfg.FirehoseDeliveryStream == "" || cfg.AWSRegion == "" {
+		return nil, fmt.Errorf("FIREHOSE_DELIVERY_STREAM and AWS_REGION are required for the firehose sink")
+	}
+
+	client := firehose.NewFromConfig(cfg.AWSConfig)
+
+	return NewFirehoseSink(client, cfg.FirehoseDeliveryStream, retry.Policy{
+		MaxAttempts:    cfg.SinkRetryMaxAttempts,
+		InitialBackoff: cfg.SinkRetryInitialBackoff,
+		MaxBackoff:     cfg.SinkRetryMaxBackoff,
+	}), nil
+}
+
+func NewFirehoseSink(client FirehoseClient, deliveryStream string, retryPolicy retry.Policy) *FirehoseSink {
+	return &FirehoseSink{
+		client:         client,
+		deliveryStream: deliveryStream,
+		retry:          retryPolicy,
+	}
+}
+
+// UploadAuditLogs sends a record per audit log, split into as many
+// PutRecordBatch calls as needed to stay within the per-call limits. Records
+// that fail individually are retried until every record has been accepted.
+func (f *FirehoseSink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	records, err := encodeStreamRecords(auditLogType, id, data, firehoseMaxRecordBytes)
+	if err != nil {
+		return "", err
+	}
+
+	sizes := make([]int, len(records))
+	for i, r := range records {
+		sizes[i] = len(r)
+	}
+
+	for _, b := range recordBatches(sizes, firehoseMaxRecordsPerBatch, firehoseMaxBatchBytes) {
+		batch := make([]firehosetypes.Record, 0, b.end-b.start)
+		for _, r := range records[b.start:b.end] {
+			batch = append(batch, firehosetypes.Record{Data: r})
+		}
+
+		if err := f.putRecordBatch(ctx, batch); err != nil {
+			return "", fmt.Errorf("error sending records to Firehose: %w", err)
+		}
+	}
+
+	return fmt.Sprintf("firehose://%s", f.deliveryStream), nil
+}
+
+func (f *FirehoseSink) putRecordBatch(ctx context.Context, batch []firehosetypes.Record) error {
+	pending := batch
+
+	return retry.Do(ctx, f.retry, func() error {
+		out, err := f.client.PutRecordBatch(ctx, &firehose.PutRecordBatchInput{
+			DeliveryStreamName: aws.String(f.deliveryStream),
+			Records:            pending,
+		})
+		if err != nil {
+			return err
+		}
+
+		if aws.ToInt32(out.FailedPutCount) == 0 {
+			return nil
+		}
+
+		var failed []firehosetypes.Record
+		var lastErr string
+		for i, result := range out.RequestResponses {
+			if result.ErrorCode != nil {
+				failed = append(failed, pending[i])
+				lastErr = fmt.Sprintf("%s: %s", aws.ToString(result.ErrorCode), aws.ToString(result.ErrorMessage))
+			}
+		}
+
+		logger.FromContext(ctx).Warn("some records failed to send", "failed", len(failed), "total", len(pending))
+		pending = failed
+
+		return retry.Retryable(fmt.Errorf("%d records failed, last error: %s", len(failed), lastErr), 0)
+	})
+}
+
+// encodeStreamRecords encodes a newline-terminated JSON record per audit log,
+// so that records concatenated by the destination stay one per line
+func encodeStreamRecords(auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry, maxRecordBytes int) ([][]byte, error) {
+	records := make([][]byte, 0, len(data))
+	for _, entry := range data {
+		record, err := json.Marshal(streamRecord{
+			LogType:  string(auditLogType),
+			OwnerID:  id,
+			Cursor:   entry.Cursor,
+			AuditLog: entry.AuditLog,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling record: %w", err)
+		}
+		record = append(record, '\n')
+
+		if len(record) > maxRecordBytes {
+			return nil, fmt.Errorf("audit log %s is %d bytes, more than the record limit of %d", entry.AuditLog.ID, len(record), maxRecordBytes)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// batchRange is a half-open range of records sent in a single call
+type batchRange struct {
+	start, end int
+}
+
+// recordBatches splits records of the given sizes into ranges within the count
+// and size limits of a single call
+func recordBatches(sizes []int, maxCount, maxBytes int) []batchRange {
+	var batches []batchRange
+	start, size := 0, 0
+
+	for i, s := range sizes {
+		if i > start && (i-start == maxCount || size+s > maxBytes) {
+			batches = append(batches, batchRange{start, i})
+			start, size = i, 0
+		}
+		size += s
+	}
+
+	if start < len(sizes) {
+		batches = append(batches, batchRange{start, len(sizes)})
+	}
+
+	return batches
+}
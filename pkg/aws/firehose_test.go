@@ -0,0 +1,178 @@
+package aws_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	firehosetypes "github.com/aws/aws-sdk-go-v2/service/firehose/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/aws"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+var fastRetry = retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+// mockFirehoseClient accepts records, failing every other record in the first
+// failFirst calls
+type mockFirehoseClient struct {
+	mu sync.Mutex
+
+	calls     [][]firehosetypes.Record
+	accepted  [][]byte
+	failFirst int
+	err       error
+}
+
+func (m *mockFirehoseClient) PutRecordBatch(ctx context.Context, params *firehose.PutRecordBatchInput, optFns ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, params.Records)
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	size := 0
+	for _, r := range params.Records {
+		size += len(r.Data)
+	}
+	if len(params.Records) > 500 || size > 4*1024*1024 {
+		return nil, &firehosetypes.InvalidArgumentException{Message: awssdk.String("batch exceeds limits")}
+	}
+
+	out := &firehose.PutRecordBatchOutput{FailedPutCount: awssdk.Int32(0)}
+	for i, r := range params.Records {
+		if len(m.calls) <= m.failFirst && i%2 == 0 {
+			out.FailedPutCount = awssdk.Int32(*out.FailedPutCount + 1)
+			out.RequestResponses = append(out.RequestResponses, firehosetypes.PutRecordBatchResponseEntry{
+				ErrorCode:    awssdk.String("ServiceUnavailableException"),
+				ErrorMessage: awssdk.String("Slow down."),
+			})
+			continue
+		}
+
+		m.accepted = append(m.accepted, r.Data)
+		out.RequestResponses = append(out.RequestResponses, firehosetypes.PutRecordBatchResponseEntry{
+			RecordId: awssdk.String("record-id"),
+		})
+	}
+
+	return out, nil
+}
+
+func TestFirehoseUploadAuditLogs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	testDate := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	t.Run("sends a newline-delimited record per audit log", func(t *testing.T) {
+		t.Parallel()
+		client := &mockFirehoseClient{}
+		sink := aws.NewFirehoseSink(client, "render-audit-logs", fastRetry)
+
+		testData := testhelpers.CreateTestAuditLogs(3, testDate)
+
+		location, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+		require.Equal(t, "firehose://render-audit-logs", location)
+
+		require.Len(t, client.calls, 1)
+		require.Len(t, client.accepted, 3)
+		for i, data := range client.accepted {
+			require.True(t, bytes.HasSuffix(data, []byte("\n")))
+			require.Equal(t, 1, bytes.Count(data, []byte("\n")))
+
+			var record struct {
+				LogType  string `json:"log_type"`
+				OwnerID  string `json:"owner_id"`
+				AuditLog struct {
+					ID string `json:"id"`
+				} `json:"auditLog"`
+			}
+			require.NoError(t, json.Unmarshal(data, &record))
+			require.Equal(t, "workspace", record.LogType)
+			require.Equal(t, "tea-123", record.OwnerID)
+			require.Equal(t, testData[i].AuditLog.ID, record.AuditLog.ID)
+		}
+	})
+
+	t.Run("retries only the failed records", func(t *testing.T) {
+		t.Parallel()
+		client := &mockFirehoseClient{failFirst: 1}
+		sink := aws.NewFirehoseSink(client, "render-audit-logs", fastRetry)
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.OrganizationAuditLog, "org-456", testhelpers.CreateTestAuditLogs(5, testDate))
+		require.NoError(t, err)
+
+		require.Len(t, client.calls, 2)
+		require.Len(t, client.calls[0], 5)
+		require.Len(t, client.calls[1], 3)
+		require.Len(t, client.accepted, 5)
+	})
+
+	t.Run("returns error when records keep failing", func(t *testing.T) {
+		t.Parallel()
+		client := &mockFirehoseClient{failFirst: 10}
+		sink := aws.NewFirehoseSink(client, "render-audit-logs", fastRetry)
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(4, testDate))
+		require.ErrorContains(t, err, "ServiceUnavailableException")
+		require.Len(t, client.calls, 3)
+	})
+
+	t.Run("returns error when the call fails", func(t *testing.T) {
+		t.Parallel()
+		client := &mockFirehoseClient{err: &firehosetypes.ResourceNotFoundException{}}
+		sink := aws.NewFirehoseSink(client, "render-audit-logs", fastRetry)
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(4, testDate))
+		var notFound *firehosetypes.ResourceNotFoundException
+		require.True(t, errors.As(err, &notFound))
+		require.Len(t, client.calls, 1)
+	})
+
+	t.Run("splits batches at the per-call limits", func(t *testing.T) {
+		t.Parallel()
+		client := &mockFirehoseClient{}
+		sink := aws.NewFirehoseSink(client, "render-audit-logs", fastRetry)
+
+		testData := testhelpers.CreateTestAuditLogs(1005, testDate)
+		for i := range 5 {
+			testData[i].AuditLog.Metadata = map[string]string{"large": strings.Repeat("x", 900*1024)}
+		}
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+
+		require.Len(t, client.accepted, 1005)
+		require.Len(t, client.calls[0], 4)
+		for _, call := range client.calls {
+			require.LessOrEqual(t, len(call), 500)
+		}
+	})
+
+	t.Run("rejects audit logs larger than the record limit", func(t *testing.T) {
+		t.Parallel()
+		client := &mockFirehoseClient{}
+		sink := aws.NewFirehoseSink(client, "render-audit-logs", fastRetry)
+
+		testData := testhelpers.CreateTestAuditLogs(1, testDate)
+		testData[0].AuditLog.Metadata = map[string]string{"large": strings.Repeat("x", 1024*1024)}
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.ErrorContains(t, err, "record limit")
+		require.Empty(t, client.calls)
+	})
+}
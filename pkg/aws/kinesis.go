@@ -0,0 +1,127 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/logger"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+// Limits of PutRecords, where a record's size includes its partition key
+// https://docs.aws.amazon.com/kinesis/latest/APIReference/API_PutRecords.html
+const (
+	kinesisMaxRecordsPerBatch = 500
+	kinesisMaxBatchBytes      = 5 * 1024 * 1024
+	kinesisMaxRecordBytes     = 1024 * 1024
+)
+
+type KinesisClient interface {
+	PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error)
+}
+
+// KinesisSink sends audit logs to a Kinesis data stream as newline-delimited
+// JSON records, partitioned by workspace or organization ID
+type KinesisSink struct {
+	client     KinesisClient
+	streamName string
+	retry      retry.Policy
+}
+
+func NewKinesisSinkFromConfig(ctx context.Context, cfg *env.Config) (*KinesisSink, error) {
+	if cfg.KinesisStreamName == "" || cfg.AWSRegion == "" {
+		return nil, fmt.Errorf("KINESIS_STREAM_NAME and AWS_REGION are required for the kinesis sink")
+	}
+
+	client := kinesis.NewFromConfig(cfg.AWSConfig)
+
+	return NewKinesisSink(client, cfg.KinesisStreamName, retry.Policy{
+		MaxAttempts:    cfg.SinkRetryMaxAttempts,
+		InitialBackoff: cfg.SinkRetryInitialBackoff,
+		MaxBackoff:     cfg.SinkRetryMaxBackoff,
+	}), nil
+}
+
+func NewKinesisSink(client KinesisClient, streamName string, retryPolicy retry.Policy) *KinesisSink {
+	return &KinesisSink{
+		client:     client,
+		streamName: streamName,
+		retry:      retryPolicy,
+	}
+}
+
+// UploadAuditLogs sends a record per audit log, split into as many PutRecords
+// calls as needed to stay within the per-call limits. Records that fail
+// individually, e.g. because a shard is throttled, are retried until every
+// record has been accepted.
+//
+// Every record of a call shares the owner's partition key, and so its shard.
+// A retry resends everything from the first failed record, including records
+// that were accepted after it, so the shard holds each audit log's last copy
+// in order, at the cost of duplicates.
+func (k *KinesisSink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	records, err := encodeStreamRecords(auditLogType, id, data, kinesisMaxRecordBytes-len(id))
+	if err != nil {
+		return "", err
+	}
+
+	sizes := make([]int, len(records))
+	for i, r := range records {
+		sizes[i] = len(r) + len(id)
+	}
+
+	for _, b := range recordBatches(sizes, kinesisMaxRecordsPerBatch, kinesisMaxBatchBytes) {
+		batch := make([]kinesistypes.PutRecordsRequestEntry, 0, b.end-b.start)
+		for _, r := range records[b.start:b.end] {
+			batch = append(batch, kinesistypes.PutRecordsRequestEntry{
+				Data:         r,
+				PartitionKey: aws.String(id),
+			})
+		}
+
+		if err := k.putRecords(ctx, batch); err != nil {
+			return "", fmt.Errorf("error sending records to Kinesis: %w", err)
+		}
+	}
+
+	return fmt.Sprintf("kinesis://%s", k.streamName), nil
+}
+
+func (k *KinesisSink) putRecords(ctx context.Context, batch []kinesistypes.PutRecordsRequestEntry) error {
+	pending := batch
+
+	return retry.Do(ctx, k.retry, func() error {
+		out, err := k.client.PutRecords(ctx, &kinesis.PutRecordsInput{
+			StreamName: aws.String(k.streamName),
+			Records:    pending,
+		})
+		if err != nil {
+			return err
+		}
+
+		if aws.ToInt32(out.FailedRecordCount) == 0 {
+			return nil
+		}
+
+		first := slices.IndexFunc(out.Records, func(result kinesistypes.PutRecordsResultEntry) bool {
+			return result.ErrorCode != nil
+		})
+		if first < 0 {
+			return fmt.Errorf("%d records failed without an error code", aws.ToInt32(out.FailedRecordCount))
+		}
+		failed := out.Records[first]
+
+		logger.FromContext(ctx).Warn("some records failed to send, resending from the first failure", "failed", aws.ToInt32(out.FailedRecordCount), "resent", len(pending)-first, "total", len(pending))
+		pending = pending[first:]
+
+		return retry.Retryable(fmt.Errorf("%d records failed, first error: %s: %s", aws.ToInt32(out.FailedRecordCount), aws.ToString(failed.ErrorCode), aws.ToString(failed.ErrorMessage)), 0)
+	})
+}
@@ -0,0 +1,143 @@
+package aws_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/aws"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+// mockKinesisClient accepts records in order, throttling the records for
+// which throttle returns true
+type mockKinesisClient struct {
+	mu sync.Mutex
+
+	calls    [][]kinesistypes.PutRecordsRequestEntry
+	accepted []kinesistypes.PutRecordsRequestEntry
+	// throttle is called with the 1-based call number and each record's index
+	throttle func(call, i int) bool
+}
+
+func (m *mockKinesisClient) PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, params.Records)
+
+	out := &kinesis.PutRecordsOutput{FailedRecordCount: awssdk.Int32(0)}
+	for i, r := range params.Records {
+		if m.throttle != nil && m.throttle(len(m.calls), i) {
+			out.FailedRecordCount = awssdk.Int32(awssdk.ToInt32(out.FailedRecordCount) + 1)
+			out.Records = append(out.Records, kinesistypes.PutRecordsResultEntry{
+				ErrorCode:    awssdk.String("ProvisionedThroughputExceededException"),
+				ErrorMessage: awssdk.String("Rate exceeded for shard shardId-000000000000"),
+			})
+			continue
+		}
+
+		m.accepted = append(m.accepted, r)
+		out.Records = append(out.Records, kinesistypes.PutRecordsResultEntry{
+			SequenceNumber: awssdk.String("1"),
+			ShardId:        awssdk.String("shardId-000000000000"),
+		})
+	}
+
+	return out, nil
+}
+
+func TestKinesisUploadAuditLogs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	testDate := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	t.Run("partitions records by owner ID", func(t *testing.T) {
+		t.Parallel()
+		client := &mockKinesisClient{}
+		sink := aws.NewKinesisSink(client, "render-audit-logs", fastRetry)
+
+		location, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(3, testDate))
+		require.NoError(t, err)
+		require.Equal(t, "kinesis://render-audit-logs", location)
+
+		require.Len(t, client.accepted, 3)
+		for _, r := range client.accepted {
+			require.Equal(t, "tea-123", *r.PartitionKey)
+			require.Equal(t, byte('\n'), r.Data[len(r.Data)-1])
+		}
+	})
+
+	t.Run("retries throttled records", func(t *testing.T) {
+		t.Parallel()
+		// Throttles the last record in the first two calls
+		client := &mockKinesisClient{throttle: func(call, i int) bool {
+			return call == 1 && i == 3 || call == 2 && i == 0
+		}}
+		sink := aws.NewKinesisSink(client, "render-audit-logs", fastRetry)
+
+		testData := testhelpers.CreateTestAuditLogs(4, testDate)
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+
+		require.Len(t, client.calls, 3)
+		require.Len(t, client.calls[0], 4)
+		require.Len(t, client.calls[1], 1)
+		require.Len(t, client.calls[2], 1)
+		require.Len(t, client.accepted, 4)
+		require.Contains(t, string(client.accepted[3].Data), testData[3].AuditLog.ID)
+	})
+
+	t.Run("resends from the first throttled record to keep order", func(t *testing.T) {
+		t.Parallel()
+		client := &mockKinesisClient{throttle: func(call, i int) bool {
+			return call == 1 && (i == 1 || i == 3)
+		}}
+		sink := aws.NewKinesisSink(client, "render-audit-logs", fastRetry)
+
+		testData := testhelpers.CreateTestAuditLogs(4, testDate)
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+
+		require.Len(t, client.calls, 2)
+		require.Equal(t, client.calls[0][1:], client.calls[1])
+
+		// The last copy of each audit log is in order
+		last := map[string]int{}
+		for i, r := range client.accepted {
+			for _, entry := range testData {
+				if strings.Contains(string(r.Data), entry.AuditLog.ID) {
+					last[entry.AuditLog.ID] = i
+				}
+			}
+		}
+		for i := 1; i < len(testData); i++ {
+			require.Less(t, last[testData[i-1].AuditLog.ID], last[testData[i].AuditLog.ID])
+		}
+	})
+
+	t.Run("splits batches at the record count limit", func(t *testing.T) {
+		t.Parallel()
+		client := &mockKinesisClient{}
+		sink := aws.NewKinesisSink(client, "render-audit-logs", fastRetry)
+
+		_, err := sink.UploadAuditLogs(ctx, auditlogs.OrganizationAuditLog, "org-456", testhelpers.CreateTestAuditLogs(1001, testDate))
+		require.NoError(t, err)
+
+		require.Len(t, client.calls, 3)
+		require.Len(t, client.calls[0], 500)
+		require.Len(t, client.calls[1], 500)
+		require.Len(t, client.calls[2], 1)
+	})
+}
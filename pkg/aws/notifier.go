@@ -0,0 +1,151 @@
+package aws
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+// Manifest describes an uploaded object
+type Manifest struct {
+	URI            string    `json:"uri"`
+	Bucket         string    `json:"bucket"`
+	Key            string    `json:"key"`
+	LogType        string    `json:"log_type"`
+	OwnerID        string    `json:"owner_id"`
+	Count          int       `json:"count"`
+	FirstTimestamp time.Time `json:"first_timestamp"`
+	LastTimestamp  time.Time `json:"last_timestamp"`
+	// SHA256 is the hex encoded SHA-256 of the object as stored
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// Notifier publishes a manifest for every object the uploader writes
+type Notifier interface {
+	Notify(ctx context.Context, m *Manifest) error
+}
+
+type SQSClient interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+type SNSClient interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// SQSNotifier sends manifests to an SQS queue. For FIFO queues, manifests are
+// grouped by workspace or organization so each one's are delivered in order.
+type SQSNotifier struct {
+	client   SQSClient
+	queueURL string
+}
+
+func NewSQSNotifier(client SQSClient, queueURL string) *SQSNotifier {
+	return &SQSNotifier{client: client, queueURL: queueURL}
+}
+
+func (n *SQSNotifier) Notify(ctx context.Context, m *Manifest) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error marshaling manifest: %w", err)
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(n.queueURL),
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"log_type": {DataType: aws.String("String"), StringValue: aws.String(m.LogType)},
+			"owner_id": {DataType: aws.String("String"), StringValue: aws.String(m.OwnerID)},
+		},
+	}
+	if strings.HasSuffix(n.queueURL, ".fifo") {
+		input.MessageGroupId = aws.String(messageGroupID(m))
+		input.MessageDeduplicationId = aws.String(deduplicationID(m))
+	}
+
+	if _, err := n.client.SendMessage(ctx, input); err != nil {
+		return fmt.Errorf("error sending manifest to SQS: %w", err)
+	}
+
+	return nil
+}
+
+// SNSNotifier publishes manifests to an SNS topic. For FIFO topics, manifests
+// are grouped by workspace or organization so each one's are delivered in
+// order.
+type SNSNotifier struct {
+	client   SNSClient
+	topicARN string
+}
+
+func NewSNSNotifier(client SNSClient, topicARN string) *SNSNotifier {
+	return &SNSNotifier{client: client, topicARN: topicARN}
+}
+
+func (n *SNSNotifier) Notify(ctx context.Context, m *Manifest) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error marshaling manifest: %w", err)
+	}
+
+	input := &sns.PublishInput{
+		TopicArn: aws.String(n.topicARN),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"log_type": {DataType: aws.String("String"), StringValue: aws.String(m.LogType)},
+			"owner_id": {DataType: aws.String("String"), StringValue: aws.String(m.OwnerID)},
+		},
+	}
+	if strings.HasSuffix(n.topicARN, ".fifo") {
+		input.MessageGroupId = aws.String(messageGroupID(m))
+		input.MessageDeduplicationId = aws.String(deduplicationID(m))
+	}
+
+	if _, err := n.client.Publish(ctx, input); err != nil {
+		return fmt.Errorf("error publishing manifest to SNS: %w", err)
+	}
+
+	return nil
+}
+
+func newManifest(bucket, key string, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry, body []byte) *Manifest {
+	sum := sha256.Sum256(body)
+
+	return &Manifest{
+		URI:            fmt.Sprintf("s3://%s/%s", bucket, key),
+		Bucket:         bucket,
+		Key:            key,
+		LogType:        string(auditLogType),
+		OwnerID:        id,
+		Count:          len(data),
+		FirstTimestamp: data[0].AuditLog.Timestamp,
+		LastTimestamp:  data[len(data)-1].AuditLog.Timestamp,
+		SHA256:         hex.EncodeToString(sum[:]),
+		Size:           len(body),
+	}
+}
+
+func messageGroupID(m *Manifest) string {
+	return fmt.Sprintf("%s-%s", m.LogType, m.OwnerID)
+}
+
+// deduplicationID is stable across re-uploads of the same object, which
+// always has the same key
+func deduplicationID(m *Manifest) string {
+	sum := sha256.Sum256([]byte(m.Key))
+	return hex.EncodeToString(sum[:])
+}
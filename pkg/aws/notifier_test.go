@@ -0,0 +1,153 @@
+package aws_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/aws"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+type mockSQSClient struct {
+	messages []*sqs.SendMessageInput
+	err      error
+}
+
+func (m *mockSQSClient) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.messages = append(m.messages, params)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+type mockSNSClient struct {
+	messages []*sns.PublishInput
+}
+
+func (m *mockSNSClient) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	m.messages = append(m.messages, params)
+	return &sns.PublishOutput{}, nil
+}
+
+func TestUploadAuditLogsNotifications(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	testData := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+
+	newS3Client := func(body *[]byte, key *string) *mockS3Client {
+		return &mockS3Client{
+			putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				var err error
+				*body, err = io.ReadAll(params.Body)
+				*key = *params.Key
+				return &s3.PutObjectOutput{}, err
+			},
+		}
+	}
+
+	t.Run("sends a manifest of the object to SQS and SNS", func(t *testing.T) {
+		t.Parallel()
+		var body []byte
+		var key string
+		sqsClient := &mockSQSClient{}
+		snsClient := &mockSNSClient{}
+
+		uploader, err := aws.NewUploaderWithOptions(ctx, newS3Client(&body, &key), "test-bucket", "test-region", aws.UploaderOptions{
+			Notifiers: []aws.Notifier{
+				aws.NewSQSNotifier(sqsClient, "https://sqs.us-west-2.amazonaws.com/123456789012/audit-logs"),
+				aws.NewSNSNotifier(snsClient, "arn:aws:sns:us-west-2:123456789012:audit-logs"),
+			},
+		})
+		require.NoError(t, err)
+
+		s3URI, err := uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+
+		require.Len(t, sqsClient.messages, 1)
+		require.Len(t, snsClient.messages, 1)
+
+		sqsMessage := sqsClient.messages[0]
+		require.Nil(t, sqsMessage.MessageGroupId)
+		require.Equal(t, "workspace", *sqsMessage.MessageAttributes["log_type"].StringValue)
+		require.Equal(t, "tea-123", *sqsMessage.MessageAttributes["owner_id"].StringValue)
+		require.Equal(t, *sqsMessage.MessageBody, *snsClient.messages[0].Message)
+
+		var manifest aws.Manifest
+		require.NoError(t, json.Unmarshal([]byte(*sqsMessage.MessageBody), &manifest))
+
+		sum := sha256.Sum256(body)
+		require.Equal(t, aws.Manifest{
+			URI:            s3URI,
+			Bucket:         "test-bucket",
+			Key:            key,
+			LogType:        "workspace",
+			OwnerID:        "tea-123",
+			Count:          3,
+			FirstTimestamp: testData[0].AuditLog.Timestamp,
+			LastTimestamp:  testData[2].AuditLog.Timestamp,
+			SHA256:         hex.EncodeToString(sum[:]),
+			Size:           len(body),
+		}, manifest)
+	})
+
+	t.Run("groups FIFO messages by owner", func(t *testing.T) {
+		t.Parallel()
+		var body []byte
+		var key string
+		sqsClient := &mockSQSClient{}
+		snsClient := &mockSNSClient{}
+
+		uploader, err := aws.NewUploaderWithOptions(ctx, newS3Client(&body, &key), "test-bucket", "test-region", aws.UploaderOptions{
+			Notifiers: []aws.Notifier{
+				aws.NewSQSNotifier(sqsClient, "https://sqs.us-west-2.amazonaws.com/123456789012/audit-logs.fifo"),
+				aws.NewSNSNotifier(snsClient, "arn:aws:sns:us-west-2:123456789012:audit-logs.fifo"),
+			},
+		})
+		require.NoError(t, err)
+
+		_, err = uploader.UploadAuditLogs(ctx, auditlogs.OrganizationAuditLog, "org-456", testData)
+		require.NoError(t, err)
+		_, err = uploader.UploadAuditLogs(ctx, auditlogs.OrganizationAuditLog, "org-456", testData)
+		require.NoError(t, err)
+
+		require.Len(t, sqsClient.messages, 2)
+		require.Equal(t, "organization-org-456", *sqsClient.messages[0].MessageGroupId)
+		require.Equal(t, "organization-org-456", *snsClient.messages[0].MessageGroupId)
+
+		// Re-uploading the same object is deduplicated
+		require.NotEmpty(t, *sqsClient.messages[0].MessageDeduplicationId)
+		require.Equal(t, *sqsClient.messages[0].MessageDeduplicationId, *sqsClient.messages[1].MessageDeduplicationId)
+	})
+
+	t.Run("returns error when the notification fails", func(t *testing.T) {
+		t.Parallel()
+		var body []byte
+		var key string
+		sqsClient := &mockSQSClient{err: errors.New("access denied")}
+
+		uploader, err := aws.NewUploaderWithOptions(ctx, newS3Client(&body, &key), "test-bucket", "test-region", aws.UploaderOptions{
+			Notifiers: []aws.Notifier{aws.NewSQSNotifier(sqsClient, "https://sqs.us-west-2.amazonaws.com/123456789012/audit-logs")},
+		})
+		require.NoError(t, err)
+
+		s3URI, err := uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.ErrorContains(t, err, "error sending manifest to SQS")
+		require.Empty(t, s3URI)
+		require.True(t, bytes.HasPrefix(body, []byte{0x1f, 0x8b}), "object should have been written before notifying")
+	})
+}
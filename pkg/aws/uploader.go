@@ -2,17 +2,18 @@ package aws
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 
+	"github.com/renderinc/render-auditlogs/pkg/archive"
 	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
 	"github.com/renderinc/render-auditlogs/pkg/render"
 )
 
@@ -25,6 +26,13 @@ type UploaderOptions struct {
 	UseKMS           bool
 	KMSKeyID         string
 	BucketKeyEnabled bool
+	// DisableSSE omits server-side encryption headers, for S3-compatible
+	// stores that reject them
+	DisableSSE bool
+	// Notifiers are sent a manifest of every object after it is written
+	Notifiers []Notifier
+	// Archive controls how objects are encoded
+	Archive archive.Options
 }
 
 type Uploader struct {
@@ -33,11 +41,56 @@ type Uploader struct {
 	opts   UploaderOptions
 }
 
+// NewUploaderFromConfig creates an uploader for the bucket and encryption
+// settings in cfg
+func NewUploaderFromConfig(ctx context.Context, cfg *env.Config) (*Uploader, error) {
+	if cfg.S3Bucket == "" || cfg.AWSRegion == "" {
+		return nil, fmt.Errorf("S3_BUCKET and AWS_REGION are required for the s3 sink")
+	}
+
+	archiveOpts, err := archive.OptionsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifiers []Notifier
+	if cfg.S3NotifySQSQueueURL != "" {
+		notifiers = append(notifiers, NewSQSNotifier(sqs.NewFromConfig(cfg.AWSConfig), cfg.S3NotifySQSQueueURL))
+	}
+	if cfg.S3NotifySNSTopicARN != "" {
+		notifiers = append(notifiers, NewSNSNotifier(sns.NewFromConfig(cfg.AWSConfig), cfg.S3NotifySNSTopicARN))
+	}
+
+	client := s3.NewFromConfig(cfg.AWSConfig, func(o *s3.Options) {
+		if cfg.S3Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.S3Endpoint)
+			// S3-compatible stores don't all support the flexible checksums
+			// the SDK sends by default
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+		o.UsePathStyle = cfg.S3UsePathStyle
+	})
+
+	return NewUploaderWithOptions(ctx, client, cfg.S3Bucket, cfg.AWSRegion, UploaderOptions{
+		UseKMS:           cfg.S3UseKMS,
+		KMSKeyID:         cfg.S3KMSKeyID,
+		BucketKeyEnabled: cfg.S3BucketKeyEnabled,
+		DisableSSE:       cfg.S3DisableSSE,
+		Notifiers:        notifiers,
+		Archive:          archiveOpts,
+	})
+}
+
 func NewUploader(ctx context.Context, client S3Client, bucket, region string) (*Uploader, error) {
 	return NewUploaderWithOptions(ctx, client, bucket, region, UploaderOptions{})
 }
 
 func NewUploaderWithOptions(ctx context.Context, client S3Client, bucket, region string, opts UploaderOptions) (*Uploader, error) {
+	if opts.DisableSSE && opts.UseKMS {
+		return nil, fmt.Errorf("KMS encryption cannot be used when server-side encryption is disabled")
+	}
+
 	return &Uploader{
 		client: client,
 		bucket: bucket,
@@ -46,36 +99,50 @@ func NewUploaderWithOptions(ctx context.Context, client S3Client, bucket, region
 }
 
 // UploadAuditLogs uploads audit logs to S3 with partitioned path structure
-// Path format: workspace={workspaceID}/year={year}/month={month}/day={day}/hour={hour}/audit-logs-{timestamp}.json.gz
+// Path format: see archive.generateKey
 func (u *Uploader) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
-	// Marshal data to JSON
-	jsonData, err := json.Marshal(data)
+	obj, err := archive.NewObject(auditLogType, id, data, u.opts.Archive)
 	if err != nil {
-		return "", fmt.Errorf("error marshaling JSON: %w", err)
+		return "", err
 	}
 
-	// Compress data with gzip
-	var compressedData bytes.Buffer
-	gzWriter := gzip.NewWriter(&compressedData)
-	if _, err := gzWriter.Write(jsonData); err != nil {
-		return "", fmt.Errorf("error compressing data: %w", err)
+	// Upload to S3
+	putInput := &s3.PutObjectInput{
+		Bucket:      aws.String(u.bucket),
+		Key:         aws.String(obj.Key),
+		Body:        bytes.NewReader(obj.Body),
+		ContentType: aws.String(obj.ContentType),
 	}
-	if err := gzWriter.Close(); err != nil {
-		return "", fmt.Errorf("error closing gzip writer: %w", err)
+
+	if obj.ContentEncoding != "" {
+		putInput.ContentEncoding = aws.String(obj.ContentEncoding)
 	}
 
-	// Generate S3 key with partitioned structure
-	key := generateS3Key(auditLogType, id, data[0].AuditLog.Timestamp)
+	u.configureEncryption(putInput)
 
-	// Upload to S3
-	putInput := &s3.PutObjectInput{
-		Bucket:      aws.String(u.bucket),
-		Key:         aws.String(key),
-		Body:        bytes.NewReader(compressedData.Bytes()),
-		ContentType: aws.String("application/gzip"),
+	_, err = u.client.PutObject(ctx, putInput)
+	if err != nil {
+		return "", fmt.Errorf("error uploading to S3: %w", err)
+	}
+
+	// A failed notification fails the upload so that the checkpoint isn't
+	// advanced, and the retry overwrites the same object and notifies again
+	manifest := newManifest(u.bucket, obj.Key, auditLogType, id, data, obj.Body)
+	for _, n := range u.opts.Notifiers {
+		if err := n.Notify(ctx, manifest); err != nil {
+			return "", err
+		}
+	}
+
+	return manifest.URI, nil
+}
+
+// configureEncryption sets the server-side encryption headers of a put request
+func (u *Uploader) configureEncryption(putInput *s3.PutObjectInput) {
+	if u.opts.DisableSSE {
+		return
 	}
 
-	// Configure server-side encryption
 	if u.opts.UseKMS {
 		putInput.ServerSideEncryption = types.ServerSideEncryptionAwsKms
 		if u.opts.KMSKeyID != "" {
@@ -88,28 +155,4 @@ func (u *Uploader) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.L
 		// Default to SSE-S3 (AES256)
 		putInput.ServerSideEncryption = types.ServerSideEncryptionAes256
 	}
-
-	_, err = u.client.PutObject(ctx, putInput)
-	if err != nil {
-		return "", fmt.Errorf("error uploading to S3: %w", err)
-	}
-
-	s3URI := fmt.Sprintf("s3://%s/%s", u.bucket, key)
-	return s3URI, nil
-}
-
-// generateS3Key creates the partitioned S3 key
-// Format: workspace={workspaceID}/year={year}/month={month}/day={day}/audit-logs-{timestamp}.json.gz
-func generateS3Key(auditLogType auditlogs.LogType, id string, timestamp time.Time) string {
-	filename := fmt.Sprintf("audit-logs-%s.json.gz", timestamp.Format("2006-01-02_15-04-05"))
-
-	return fmt.Sprintf(
-		"%s=%s/year=%d/month=%d/day=%d/%s",
-		auditLogType,
-		id,
-		timestamp.Year(),
-		int(timestamp.Month()),
-		timestamp.Day(),
-		filename,
-	)
 }
@@ -7,16 +7,23 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/stretchr/testify/require"
 
+	"github.com/renderinc/render-auditlogs/pkg/archive"
 	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
 	"github.com/renderinc/render-auditlogs/pkg/aws"
+	"github.com/renderinc/render-auditlogs/pkg/env"
 	"github.com/renderinc/render-auditlogs/pkg/render"
 	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
 )
@@ -92,6 +99,79 @@ func TestUploadAuditLogs(t *testing.T) {
 		require.Contains(t, s3URI, "organization=org-456")
 	})
 
+	t.Run("uses the same key when re-uploading a batch", func(t *testing.T) {
+		t.Parallel()
+		var keys []string
+
+		s3Client := &mockS3Client{
+			putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				keys = append(keys, *params.Key)
+				return &s3.PutObjectOutput{}, nil
+			},
+		}
+
+		uploader, err := aws.NewUploader(ctx, s3Client, "test-bucket", "test-region")
+		require.NoError(t, err)
+
+		_, err = uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+		_, err = uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+
+		require.Len(t, keys, 2)
+		require.Equal(t, keys[0], keys[1])
+	})
+
+	t.Run("uses distinct keys for batches starting in the same second", func(t *testing.T) {
+		t.Parallel()
+		var keys []string
+
+		s3Client := &mockS3Client{
+			putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				keys = append(keys, *params.Key)
+				return &s3.PutObjectOutput{}, nil
+			},
+		}
+
+		uploader, err := aws.NewUploader(ctx, s3Client, "test-bucket", "test-region")
+		require.NoError(t, err)
+
+		otherData := testhelpers.CreateTestAuditLogs(3, testData[0].AuditLog.Timestamp)
+
+		_, err = uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+		_, err = uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", otherData)
+		require.NoError(t, err)
+
+		require.Len(t, keys, 2)
+		require.NotEqual(t, keys[0], keys[1])
+		require.Contains(t, keys[1], "audit-logs-2024-01-15_00-00-00-")
+	})
+
+	t.Run("sets Content-Encoding for transparently decoded objects", func(t *testing.T) {
+		t.Parallel()
+		var captured *s3.PutObjectInput
+
+		s3Client := &mockS3Client{
+			putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				captured = params
+				return &s3.PutObjectOutput{}, nil
+			},
+		}
+
+		uploader, err := aws.NewUploaderWithOptions(ctx, s3Client, "test-bucket", "test-region", aws.UploaderOptions{
+			Archive: archive.Options{Format: archive.FormatNDJSON, Compression: archive.CompressionZstd, ContentEncoding: true},
+		})
+		require.NoError(t, err)
+
+		_, err = uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+
+		require.True(t, strings.HasSuffix(*captured.Key, ".ndjson.zst"))
+		require.Equal(t, "application/x-ndjson", *captured.ContentType)
+		require.Equal(t, "zstd", *captured.ContentEncoding)
+	})
+
 	t.Run("returns error on S3 upload failure", func(t *testing.T) {
 		t.Parallel()
 		s3Client := &mockS3Client{
@@ -206,3 +286,98 @@ func TestUploadAuditLogs(t *testing.T) {
 		require.NotEmpty(t, s3URI)
 	})
 }
+
+func TestUploaderS3CompatibleEndpoint(t *testing.T) {
+	t.Parallel()
+
+	testData := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+
+	type request struct {
+		method string
+		path   string
+		header http.Header
+	}
+
+	newServer := func(t *testing.T) (*httptest.Server, *[]request) {
+		var mu sync.Mutex
+		var requests []request
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests = append(requests, request{method: r.Method, path: r.URL.Path, header: r.Header.Clone()})
+			mu.Unlock()
+
+			switch r.Method {
+			case http.MethodPut:
+				io.Copy(io.Discard, r.Body)
+				w.WriteHeader(http.StatusOK)
+			case http.MethodGet:
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		}))
+		t.Cleanup(server.Close)
+
+		return server, &requests
+	}
+
+	newConfig := func(endpoint string) *env.Config {
+		return &env.Config{
+			S3Bucket:       "test-bucket",
+			S3Endpoint:     endpoint,
+			S3UsePathStyle: true,
+			S3DisableSSE:   true,
+			AWSRegion:      "us-east-1",
+			AWSConfig: awssdk.Config{
+				Region:      "us-east-1",
+				Credentials: credentials.NewStaticCredentialsProvider("minioadmin", "minioadmin", ""),
+			},
+		}
+	}
+
+	t.Run("uploads with path-style addressing and no SSE headers", func(t *testing.T) {
+		t.Parallel()
+		server, requests := newServer(t)
+
+		uploader, err := aws.NewUploaderFromConfig(t.Context(), newConfig(server.URL))
+		require.NoError(t, err)
+
+		s3URI, err := uploader.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(s3URI, "s3://test-bucket/workspace=workspace-123/"))
+
+		require.Len(t, *requests, 1)
+		req := (*requests)[0]
+		require.Equal(t, http.MethodPut, req.method)
+		require.True(t, strings.HasPrefix(req.path, "/test-bucket/workspace=workspace-123/year=2024/month=1/day=15/"))
+		require.Empty(t, req.header.Get("X-Amz-Server-Side-Encryption"))
+	})
+
+	t.Run("treats a missing checkpoint as no checkpoint", func(t *testing.T) {
+		t.Parallel()
+		server, requests := newServer(t)
+
+		uploader, err := aws.NewUploaderFromConfig(t.Context(), newConfig(server.URL))
+		require.NoError(t, err)
+
+		cp, err := uploader.LoadCheckpoint(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123")
+		require.NoError(t, err)
+		require.Nil(t, cp)
+
+		require.Len(t, *requests, 1)
+		require.Equal(t, "/test-bucket/workspace=workspace-123/checkpoint.json", (*requests)[0].path)
+	})
+
+	t.Run("rejects KMS when SSE is disabled", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := newConfig("http://localhost:9000")
+		cfg.S3UseKMS = true
+
+		_, err := aws.NewUploaderFromConfig(t.Context(), cfg)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,179 @@
+package azure_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/archive"
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/azure"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+// newAzuriteContainer connects to the emulator in
+// AZURITE_TEST_CONNECTION_STRING and creates a fresh container, so every test
+// starts from an empty container
+func newAzuriteContainer(t *testing.T) (*azblob.Client, string) {
+	t.Helper()
+
+	connectionString := os.Getenv("AZURITE_TEST_CONNECTION_STRING")
+	if connectionString == "" {
+		t.Skip("AZURITE_TEST_CONNECTION_STRING is not set")
+	}
+
+	client, err := azblob.NewClientFromConnectionString(connectionString, nil)
+	require.NoError(t, err)
+
+	container := "test-" + uuid.NewString()[:8]
+	_, err = client.CreateContainer(context.Background(), container, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = client.DeleteContainer(context.Background(), container, nil)
+	})
+
+	return client, container
+}
+
+func TestAzuriteUploadAuditLogs(t *testing.T) {
+	ctx := context.Background()
+	testData := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+
+	t.Run("uploads a gzip compressed object", func(t *testing.T) {
+		client, container := newAzuriteContainer(t)
+
+		uploader, err := azure.NewUploader(ctx, client, container, azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		blobURI, err := uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+
+		key := strings.TrimPrefix(blobURI, "azblob://"+container+"/")
+		result, err := client.DownloadStream(ctx, container, key, nil)
+		require.NoError(t, err)
+		defer result.Body.Close()
+		require.Equal(t, "application/gzip", *result.ContentType)
+
+		gzReader, err := gzip.NewReader(result.Body)
+		require.NoError(t, err)
+		decompressed, err := io.ReadAll(gzReader)
+		require.NoError(t, err)
+
+		var uploadedData []render.AuditLogEntry
+		require.NoError(t, json.Unmarshal(decompressed, &uploadedData))
+		require.Equal(t, testData, uploadedData)
+	})
+
+	t.Run("sets the content encoding", func(t *testing.T) {
+		client, container := newAzuriteContainer(t)
+
+		uploader, err := azure.NewUploader(ctx, client, container, azure.UploaderOptions{
+			Archive: archive.Options{ContentEncoding: true},
+		})
+		require.NoError(t, err)
+
+		blobURI, err := uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+
+		key := strings.TrimPrefix(blobURI, "azblob://"+container+"/")
+		props, err := client.ServiceClient().NewContainerClient(container).NewBlobClient(key).GetProperties(ctx, nil)
+		require.NoError(t, err)
+		require.Equal(t, "application/json", *props.ContentType)
+		require.Equal(t, "gzip", *props.ContentEncoding)
+	})
+
+	t.Run("uploads with a customer-provided key", func(t *testing.T) {
+		client, container := newAzuriteContainer(t)
+
+		uploader, err := azure.NewUploader(ctx, client, container, azure.UploaderOptions{
+			EncryptionKey: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)),
+		})
+		require.NoError(t, err)
+
+		_, err = uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+
+		cp := &checkpoint.Checkpoint{LastCursor: "cursor-1", LastTimestamp: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)}
+		require.NoError(t, uploader.SaveCheckpoint(ctx, cp, auditlogs.WorkspaceAuditLog, "workspace-123"))
+
+		loaded, err := uploader.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "workspace-123")
+		require.NoError(t, err)
+		require.Equal(t, cp, loaded)
+	})
+}
+
+func TestAzuriteCheckpoint(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns nil before a checkpoint is saved", func(t *testing.T) {
+		client, container := newAzuriteContainer(t)
+
+		uploader, err := azure.NewUploader(ctx, client, container, azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		cp, err := uploader.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "workspace-123")
+		require.NoError(t, err)
+		require.Nil(t, cp)
+	})
+
+	t.Run("rejects a concurrent first checkpoint", func(t *testing.T) {
+		client, container := newAzuriteContainer(t)
+
+		first, err := azure.NewUploader(ctx, client, container, azure.UploaderOptions{})
+		require.NoError(t, err)
+		second, err := azure.NewUploader(ctx, client, container, azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		for _, u := range []*azure.Uploader{first, second} {
+			cp, err := u.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "workspace-123")
+			require.NoError(t, err)
+			require.Nil(t, cp)
+		}
+
+		require.NoError(t, first.SaveCheckpoint(ctx, &checkpoint.Checkpoint{LastCursor: "first"}, auditlogs.WorkspaceAuditLog, "workspace-123"))
+
+		err = second.SaveCheckpoint(ctx, &checkpoint.Checkpoint{LastCursor: "second"}, auditlogs.WorkspaceAuditLog, "workspace-123")
+		require.ErrorContains(t, err, "checkpoint was modified concurrently")
+	})
+
+	t.Run("rejects a checkpoint modified since it was loaded", func(t *testing.T) {
+		client, container := newAzuriteContainer(t)
+
+		first, err := azure.NewUploader(ctx, client, container, azure.UploaderOptions{})
+		require.NoError(t, err)
+		second, err := azure.NewUploader(ctx, client, container, azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		_, err = first.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "workspace-123")
+		require.NoError(t, err)
+		require.NoError(t, first.SaveCheckpoint(ctx, &checkpoint.Checkpoint{LastCursor: "cursor-1"}, auditlogs.WorkspaceAuditLog, "workspace-123"))
+
+		cp, err := second.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "workspace-123")
+		require.NoError(t, err)
+		require.Equal(t, "cursor-1", cp.LastCursor)
+
+		require.NoError(t, first.SaveCheckpoint(ctx, &checkpoint.Checkpoint{LastCursor: "cursor-2"}, auditlogs.WorkspaceAuditLog, "workspace-123"))
+
+		// The second uploader hasn't seen the first one's latest save
+		err = second.SaveCheckpoint(ctx, &checkpoint.Checkpoint{LastCursor: "cursor-3"}, auditlogs.WorkspaceAuditLog, "workspace-123")
+		require.ErrorContains(t, err, "checkpoint was modified concurrently")
+
+		cp, err = second.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "workspace-123")
+		require.NoError(t, err)
+		require.Equal(t, "cursor-2", cp.LastCursor)
+		require.NoError(t, second.SaveCheckpoint(ctx, &checkpoint.Checkpoint{LastCursor: "cursor-3"}, auditlogs.WorkspaceAuditLog, "workspace-123"))
+	})
+}
@@ -0,0 +1,109 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+
+	"github.com/renderinc/render-auditlogs/pkg/archive"
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+)
+
+// LoadCheckpoint reads the checkpoint from Azure Blob Storage. Returns nil if blob doesn't exist.
+func (u *Uploader) LoadCheckpoint(ctx context.Context, logType auditlogs.LogType, id string) (*checkpoint.Checkpoint, error) {
+	key := archive.CheckpointKey(logType, id)
+
+	result, err := u.client.DownloadStream(ctx, u.container, key, &azblob.DownloadStreamOptions{
+		CPKInfo: u.cpkInfo,
+	})
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			// No checkpoint blob exists yet, return nil
+			u.setETag(key, "")
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading checkpoint from Azure Blob Storage: %w", err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint body: %w", err)
+	}
+
+	var cp checkpoint.Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("error unmarshaling checkpoint: %w", err)
+	}
+
+	if result.ETag != nil {
+		u.setETag(key, *result.ETag)
+	}
+
+	return &cp, nil
+}
+
+// SaveCheckpoint writes the checkpoint to Azure Blob Storage. The write is
+// conditional on the blob not having changed since it was last loaded or
+// saved by this uploader, so concurrent runs can't silently move the
+// checkpoint backwards.
+func (u *Uploader) SaveCheckpoint(ctx context.Context, cp *checkpoint.Checkpoint, logType auditlogs.LogType, id string) error {
+	key := archive.CheckpointKey(logType, id)
+
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling checkpoint: %w", err)
+	}
+
+	conditions := &blob.ModifiedAccessConditions{}
+	if etag, ok := u.etag(key); ok {
+		if etag == "" {
+			conditions.IfNoneMatch = toPtr(azcore.ETagAny)
+		} else {
+			conditions.IfMatch = toPtr(etag)
+		}
+	}
+
+	result, err := u.client.UploadBuffer(ctx, u.container, key, data, &azblob.UploadBufferOptions{
+		HTTPHeaders:      httpHeaders("application/json", ""),
+		AccessConditions: &blob.AccessConditions{ModifiedAccessConditions: conditions},
+		CPKInfo:          u.cpkInfo,
+		CPKScopeInfo:     u.cpkScopeInfo,
+	})
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.ConditionNotMet, bloberror.BlobAlreadyExists) {
+			return fmt.Errorf("error writing checkpoint to Azure Blob Storage: checkpoint was modified concurrently: %w", err)
+		}
+		return fmt.Errorf("error writing checkpoint to Azure Blob Storage: %w", err)
+	}
+
+	if result.ETag != nil {
+		u.setETag(key, *result.ETag)
+	}
+
+	return nil
+}
+
+// etag returns the last known ETag of a checkpoint blob. An empty ETag means
+// the blob was known not to exist; ok is false if the blob was never read.
+func (u *Uploader) etag(key string) (etag azcore.ETag, ok bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	etag, ok = u.etags[key]
+	return etag, ok
+}
+
+func (u *Uploader) setETag(key string, etag azcore.ETag) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.etags[key] = etag
+}
@@ -0,0 +1,173 @@
+package azure_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/azure"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+)
+
+func blobError(status int, code bloberror.Code) error {
+	return &azcore.ResponseError{StatusCode: status, ErrorCode: string(code)}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	testTime := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	t.Run("successfully loads checkpoint", func(t *testing.T) {
+		checkpointJSON, err := json.Marshal(checkpoint.Checkpoint{LastCursor: "test-cursor-123", LastTimestamp: testTime})
+		require.NoError(t, err)
+
+		client := &mockBlobClient{
+			downloadStreamFunc: func(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error) {
+				require.Equal(t, "test-container", containerName)
+				require.Equal(t, "workspace=test-workspace/checkpoint.json", blobName)
+
+				var resp azblob.DownloadStreamResponse
+				resp.Body = io.NopCloser(bytes.NewReader(checkpointJSON))
+				return resp, nil
+			},
+		}
+
+		uploader, err := azure.NewUploader(ctx, client, "test-container", azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		cp, err := uploader.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+		require.Equal(t, "test-cursor-123", cp.LastCursor)
+		require.Equal(t, testTime, cp.LastTimestamp)
+	})
+
+	t.Run("returns nil when checkpoint does not exist", func(t *testing.T) {
+		client := &mockBlobClient{
+			downloadStreamFunc: func(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error) {
+				return azblob.DownloadStreamResponse{}, blobError(http.StatusNotFound, bloberror.BlobNotFound)
+			},
+		}
+
+		uploader, err := azure.NewUploader(ctx, client, "test-container", azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		cp, err := uploader.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+		require.Nil(t, cp)
+	})
+}
+
+func TestSaveCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	testTime := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	cp := &checkpoint.Checkpoint{LastCursor: "test-cursor-456", LastTimestamp: testTime}
+
+	t.Run("creates checkpoint only if it still does not exist", func(t *testing.T) {
+		client := &mockBlobClient{
+			downloadStreamFunc: func(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error) {
+				return azblob.DownloadStreamResponse{}, blobError(http.StatusNotFound, bloberror.BlobNotFound)
+			},
+			uploadBufferFunc: func(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.UploadBufferOptions) (azblob.UploadBufferResponse, error) {
+				require.Equal(t, "workspace=test-workspace/checkpoint.json", blobName)
+				require.Equal(t, "application/json", *o.HTTPHeaders.BlobContentType)
+
+				conditions := o.AccessConditions.ModifiedAccessConditions
+				require.Nil(t, conditions.IfMatch)
+				require.Equal(t, azcore.ETagAny, *conditions.IfNoneMatch)
+
+				var saved checkpoint.Checkpoint
+				require.NoError(t, json.Unmarshal(buffer, &saved))
+				require.Equal(t, *cp, saved)
+
+				return azblob.UploadBufferResponse{}, nil
+			},
+		}
+
+		uploader, err := azure.NewUploader(ctx, client, "test-container", azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		_, err = uploader.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+
+		err = uploader.SaveCheckpoint(ctx, cp, auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+	})
+
+	t.Run("updates checkpoint only if its ETag is unchanged", func(t *testing.T) {
+		loaded := azcore.ETag(`"0x1"`)
+		saved := azcore.ETag(`"0x2"`)
+		var ifMatch []azcore.ETag
+
+		client := &mockBlobClient{
+			downloadStreamFunc: func(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error) {
+				var resp azblob.DownloadStreamResponse
+				resp.Body = io.NopCloser(bytes.NewReader([]byte(`{"lastCursor":"c"}`)))
+				resp.ETag = &loaded
+				return resp, nil
+			},
+			uploadBufferFunc: func(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.UploadBufferOptions) (azblob.UploadBufferResponse, error) {
+				ifMatch = append(ifMatch, *o.AccessConditions.ModifiedAccessConditions.IfMatch)
+
+				var resp azblob.UploadBufferResponse
+				resp.ETag = &saved
+				return resp, nil
+			},
+		}
+
+		uploader, err := azure.NewUploader(ctx, client, "test-container", azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		_, err = uploader.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+
+		require.NoError(t, uploader.SaveCheckpoint(ctx, cp, auditlogs.WorkspaceAuditLog, "test-workspace"))
+		require.NoError(t, uploader.SaveCheckpoint(ctx, cp, auditlogs.WorkspaceAuditLog, "test-workspace"))
+
+		require.Equal(t, []azcore.ETag{loaded, saved}, ifMatch)
+	})
+
+	t.Run("returns error when checkpoint was modified concurrently", func(t *testing.T) {
+		client := &mockBlobClient{
+			uploadBufferFunc: func(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.UploadBufferOptions) (azblob.UploadBufferResponse, error) {
+				return azblob.UploadBufferResponse{}, blobError(http.StatusPreconditionFailed, bloberror.ConditionNotMet)
+			},
+		}
+
+		uploader, err := azure.NewUploader(ctx, client, "test-container", azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		err = uploader.SaveCheckpoint(ctx, cp, auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "modified concurrently")
+	})
+
+	t.Run("passes the customer-provided key when reading", func(t *testing.T) {
+		key := "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+
+		client := &mockBlobClient{
+			downloadStreamFunc: func(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error) {
+				require.NotNil(t, o.CPKInfo)
+				require.Equal(t, key, *o.CPKInfo.EncryptionKey)
+				require.Equal(t, blob.EncryptionAlgorithmTypeAES256, *o.CPKInfo.EncryptionAlgorithm)
+				return azblob.DownloadStreamResponse{}, blobError(http.StatusNotFound, bloberror.BlobNotFound)
+			},
+		}
+
+		uploader, err := azure.NewUploader(ctx, client, "test-container", azure.UploaderOptions{EncryptionKey: key})
+		require.NoError(t, err)
+
+		_, err = uploader.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+	})
+}
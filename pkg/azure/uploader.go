@@ -0,0 +1,159 @@
+package azure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+
+	"github.com/renderinc/render-auditlogs/pkg/archive"
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+type BlobClient interface {
+	UploadBuffer(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.UploadBufferOptions) (azblob.UploadBufferResponse, error)
+	DownloadStream(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error)
+}
+
+type UploaderOptions struct {
+	// EncryptionKey is a base64-encoded AES-256 customer-provided key
+	EncryptionKey string
+	// EncryptionScope is the name of an encryption scope on the account
+	EncryptionScope string
+	// Archive controls how objects are encoded
+	Archive archive.Options
+}
+
+// Uploader writes audit logs and checkpoints as block blobs in an Azure
+// Storage container
+type Uploader struct {
+	client    BlobClient
+	container string
+	opts      UploaderOptions
+
+	cpkInfo      *blob.CPKInfo
+	cpkScopeInfo *blob.CPKScopeInfo
+
+	// etags holds the ETag of each checkpoint blob as last read or written,
+	// used to make checkpoint writes conditional
+	mu    sync.Mutex
+	etags map[string]azcore.ETag
+}
+
+// NewUploaderFromConfig creates an uploader for the container and encryption
+// settings in cfg. It authenticates with AZURE_STORAGE_CONNECTION_STRING when
+// set (e.g. for Azurite), and otherwise with the default Azure credential
+// chain against AZURE_STORAGE_ACCOUNT_URL.
+func NewUploaderFromConfig(ctx context.Context, cfg *env.Config) (*Uploader, error) {
+	if cfg.AzureStorageContainer == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_CONTAINER is required for the azure sink")
+	}
+
+	archiveOpts, err := archive.OptionsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var client *azblob.Client
+
+	switch {
+	case cfg.AzureStorageConnectionString != "":
+		client, err = azblob.NewClientFromConnectionString(cfg.AzureStorageConnectionString, nil)
+	case cfg.AzureStorageAccountURL != "":
+		var cred *azidentity.DefaultAzureCredential
+		cred, err = azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, fmt.Errorf("error loading Azure credentials: %w", err)
+		}
+		client, err = azblob.NewClient(cfg.AzureStorageAccountURL, cred, nil)
+	default:
+		return nil, fmt.Errorf("AZURE_STORAGE_CONNECTION_STRING or AZURE_STORAGE_ACCOUNT_URL is required for the azure sink")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating Azure Blob client: %w", err)
+	}
+
+	return NewUploader(ctx, client, cfg.AzureStorageContainer, UploaderOptions{
+		EncryptionKey:   cfg.AzureStorageEncryptionKey,
+		EncryptionScope: cfg.AzureStorageEncryptionScope,
+		Archive:         archiveOpts,
+	})
+}
+
+func NewUploader(ctx context.Context, client BlobClient, container string, opts UploaderOptions) (*Uploader, error) {
+	u := &Uploader{
+		client:    client,
+		container: container,
+		opts:      opts,
+		etags:     map[string]azcore.ETag{},
+	}
+
+	if opts.EncryptionKey != "" && opts.EncryptionScope != "" {
+		return nil, fmt.Errorf("a customer-provided key and an encryption scope cannot be used together")
+	}
+
+	if opts.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(opts.EncryptionKey)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encryption key must be a base64-encoded 256-bit key")
+		}
+		sum := sha256.Sum256(key)
+
+		u.cpkInfo = &blob.CPKInfo{
+			EncryptionAlgorithm: toPtr(blob.EncryptionAlgorithmTypeAES256),
+			EncryptionKey:       toPtr(opts.EncryptionKey),
+			EncryptionKeySHA256: toPtr(base64.StdEncoding.EncodeToString(sum[:])),
+		}
+	}
+
+	if opts.EncryptionScope != "" {
+		u.cpkScopeInfo = &blob.CPKScopeInfo{
+			EncryptionScope: toPtr(opts.EncryptionScope),
+		}
+	}
+
+	return u, nil
+}
+
+// UploadAuditLogs uploads audit logs to Azure Blob Storage with partitioned path structure
+// Path format: see archive.generateKey
+func (u *Uploader) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	obj, err := archive.NewObject(auditLogType, id, data, u.opts.Archive)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = u.client.UploadBuffer(ctx, u.container, obj.Key, obj.Body, &azblob.UploadBufferOptions{
+		HTTPHeaders:  httpHeaders(obj.ContentType, obj.ContentEncoding),
+		CPKInfo:      u.cpkInfo,
+		CPKScopeInfo: u.cpkScopeInfo,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error uploading to Azure Blob Storage: %w", err)
+	}
+
+	blobURI := fmt.Sprintf("azblob://%s/%s", u.container, obj.Key)
+	return blobURI, nil
+}
+
+func httpHeaders(contentType, contentEncoding string) *blob.HTTPHeaders {
+	headers := &blob.HTTPHeaders{
+		BlobContentType: toPtr(contentType),
+	}
+	if contentEncoding != "" {
+		headers.BlobContentEncoding = toPtr(contentEncoding)
+	}
+	return headers
+}
+
+func toPtr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,150 @@
+package azure_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/azure"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+type mockBlobClient struct {
+	uploadBufferFunc   func(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.UploadBufferOptions) (azblob.UploadBufferResponse, error)
+	downloadStreamFunc func(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error)
+}
+
+func (m *mockBlobClient) UploadBuffer(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.UploadBufferOptions) (azblob.UploadBufferResponse, error) {
+	return m.uploadBufferFunc(ctx, containerName, blobName, buffer, o)
+}
+
+func (m *mockBlobClient) DownloadStream(ctx context.Context, containerName string, blobName string, o *azblob.DownloadStreamOptions) (azblob.DownloadStreamResponse, error) {
+	return m.downloadStreamFunc(ctx, containerName, blobName, o)
+}
+
+func TestUploadAuditLogs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	testData := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+
+	t.Run("successfully uploads audit logs", func(t *testing.T) {
+		t.Parallel()
+		var capturedBody []byte
+
+		client := &mockBlobClient{
+			uploadBufferFunc: func(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.UploadBufferOptions) (azblob.UploadBufferResponse, error) {
+				require.Equal(t, "test-container", containerName)
+				require.True(t, strings.HasPrefix(blobName, "workspace=workspace-123/year=2024/month=1/day=15/audit-logs-2024-01-15"))
+				require.Equal(t, "application/gzip", *o.HTTPHeaders.BlobContentType)
+				require.Nil(t, o.HTTPHeaders.BlobContentEncoding)
+				require.Nil(t, o.CPKInfo)
+				require.Nil(t, o.CPKScopeInfo)
+
+				capturedBody = buffer
+				return azblob.UploadBufferResponse{}, nil
+			},
+		}
+
+		uploader, err := azure.NewUploader(ctx, client, "test-container", azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		blobURI, err := uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(blobURI, "azblob://test-container/workspace=workspace-123/"))
+
+		gzReader, err := gzip.NewReader(bytes.NewReader(capturedBody))
+		require.NoError(t, err)
+		defer gzReader.Close()
+
+		decompressed, err := io.ReadAll(gzReader)
+		require.NoError(t, err)
+
+		var uploadedData []render.AuditLogEntry
+		require.NoError(t, json.Unmarshal(decompressed, &uploadedData))
+		require.Equal(t, testData, uploadedData)
+	})
+
+	t.Run("uses customer-provided key", func(t *testing.T) {
+		t.Parallel()
+		key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+
+		client := &mockBlobClient{
+			uploadBufferFunc: func(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.UploadBufferOptions) (azblob.UploadBufferResponse, error) {
+				require.NotNil(t, o.CPKInfo)
+				require.Equal(t, key, *o.CPKInfo.EncryptionKey)
+				require.Equal(t, blob.EncryptionAlgorithmTypeAES256, *o.CPKInfo.EncryptionAlgorithm)
+				require.NotEmpty(t, *o.CPKInfo.EncryptionKeySHA256)
+				require.Nil(t, o.CPKScopeInfo)
+				return azblob.UploadBufferResponse{}, nil
+			},
+		}
+
+		uploader, err := azure.NewUploader(ctx, client, "test-container", azure.UploaderOptions{EncryptionKey: key})
+		require.NoError(t, err)
+
+		_, err = uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+	})
+
+	t.Run("uses encryption scope", func(t *testing.T) {
+		t.Parallel()
+
+		client := &mockBlobClient{
+			uploadBufferFunc: func(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.UploadBufferOptions) (azblob.UploadBufferResponse, error) {
+				require.Nil(t, o.CPKInfo)
+				require.NotNil(t, o.CPKScopeInfo)
+				require.Equal(t, "audit-scope", *o.CPKScopeInfo.EncryptionScope)
+				return azblob.UploadBufferResponse{}, nil
+			},
+		}
+
+		uploader, err := azure.NewUploader(ctx, client, "test-container", azure.UploaderOptions{EncryptionScope: "audit-scope"})
+		require.NoError(t, err)
+
+		_, err = uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+	})
+
+	t.Run("rejects invalid encryption settings", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := azure.NewUploader(ctx, &mockBlobClient{}, "test-container", azure.UploaderOptions{EncryptionKey: "not-a-key"})
+		require.Error(t, err)
+
+		key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+		_, err = azure.NewUploader(ctx, &mockBlobClient{}, "test-container", azure.UploaderOptions{EncryptionKey: key, EncryptionScope: "audit-scope"})
+		require.Error(t, err)
+	})
+
+	t.Run("returns error on upload failure", func(t *testing.T) {
+		t.Parallel()
+
+		client := &mockBlobClient{
+			uploadBufferFunc: func(ctx context.Context, containerName string, blobName string, buffer []byte, o *azblob.UploadBufferOptions) (azblob.UploadBufferResponse, error) {
+				return azblob.UploadBufferResponse{}, errors.New("upload failed")
+			},
+		}
+
+		uploader, err := azure.NewUploader(ctx, client, "test-container", azure.UploaderOptions{})
+		require.NoError(t, err)
+
+		blobURI, err := uploader.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "error uploading to Azure Blob Storage")
+		require.Empty(t, blobURI)
+	})
+}
@@ -0,0 +1,22 @@
+package checkpoint
+
+import (
+	"context"
+	"time"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+)
+
+// Checkpoint represents the state to persist between runs
+type Checkpoint struct {
+	LastCursor    string    `json:"lastCursor"`
+	LastTimestamp time.Time `json:"lastTimestamp"`
+}
+
+// Store persists checkpoints between runs, independently of where the audit
+// logs themselves are written
+type Store interface {
+	// LoadCheckpoint returns nil if no checkpoint has been saved yet
+	LoadCheckpoint(ctx context.Context, logType auditlogs.LogType, id string) (*Checkpoint, error)
+	SaveCheckpoint(ctx context.Context, cp *Checkpoint, logType auditlogs.LogType, id string) error
+}
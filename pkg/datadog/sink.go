@@ -0,0 +1,235 @@
+package datadog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/httpclient"
+	"github.com/renderinc/render-auditlogs/pkg/logger"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+// Limits of the Datadog Logs intake API
+// https://docs.datadoghq.com/api/latest/logs/#send-logs
+const (
+	maxEntriesPerPayload = 1000
+	maxPayloadBytes      = 5 * 1024 * 1024
+	maxEntryBytes        = 1024 * 1024
+)
+
+const (
+	defaultSite    = "datadoghq.com"
+	defaultService = "render-auditlogs"
+	defaultTimeout = 30 * time.Second
+	source         = "render"
+)
+
+type SinkOptions struct {
+	Service string
+	// Tags are added to the ddtags of every log, e.g. "env:prod"
+	Tags  []string
+	Gzip  bool
+	Retry retry.Policy
+}
+
+// Sink sends audit logs to the Datadog Logs HTTP intake
+type Sink struct {
+	httpClient *http.Client
+	intakeURL  string
+	apiKey     string
+	opts       SinkOptions
+}
+
+// logEntry is a single log sent to the intake
+type logEntry struct {
+	Source   string          `json:"ddsource"`
+	Service  string          `json:"service"`
+	Tags     string          `json:"ddtags"`
+	Date     time.Time       `json:"date"`
+	Message  string          `json:"message"`
+	Cursor   string          `json:"cursor"`
+	AuditLog render.AuditLog `json:"auditLog"`
+	// Truncated is set when the audit log's metadata was dropped to fit
+	// within the entry size limit
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func NewSinkFromConfig(ctx context.Context, cfg *env.Config) (*Sink, error) {
+	if cfg.DatadogAPIKey == "" {
+		return nil, fmt.Errorf("DATADOG_API_KEY is required for the datadog sink")
+	}
+
+	intakeURL := cfg.DatadogIntakeURL
+	if intakeURL == "" {
+		site := cfg.DatadogSite
+		if site == "" {
+			site = defaultSite
+		}
+		intakeURL = fmt.Sprintf("https://http-intake.logs.%s/api/v2/logs", site)
+	}
+
+	httpClient := &http.Client{Timeout: cfg.SinkRequestTimeout}
+
+	return NewSink(httpClient, intakeURL, cfg.DatadogAPIKey, SinkOptions{
+		Service: cfg.DatadogService,
+		Tags:    cfg.DatadogTags,
+		Gzip:    cfg.DatadogGzip,
+		Retry: retry.Policy{
+			MaxAttempts:    cfg.SinkRetryMaxAttempts,
+			InitialBackoff: cfg.SinkRetryInitialBackoff,
+			MaxBackoff:     cfg.SinkRetryMaxBackoff,
+		},
+	})
+}
+
+func NewSink(httpClient *http.Client, intakeURL, apiKey string, opts SinkOptions) (*Sink, error) {
+	httpClient = httpclient.WithTimeout(httpClient, defaultTimeout)
+	if opts.Service == "" {
+		opts.Service = defaultService
+	}
+
+	return &Sink{
+		httpClient: httpClient,
+		intakeURL:  intakeURL,
+		apiKey:     apiKey,
+		opts:       opts,
+	}, nil
+}
+
+// UploadAuditLogs sends audit logs to the intake, split into as many requests
+// as needed to stay within the per-request count and size limits. It only
+// returns once every request has been accepted.
+func (s *Sink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	l := logger.FromContext(ctx)
+	tags := s.tags(auditLogType, id)
+
+	var batch [][]byte
+	batchBytes := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		payload := append(append([]byte("["), bytes.Join(batch, []byte(","))...), ']')
+		if err := s.send(ctx, payload); err != nil {
+			return fmt.Errorf("error sending logs to Datadog: %w", err)
+		}
+		batch = batch[:0]
+		batchBytes = 0
+		return nil
+	}
+
+	for _, entry := range data {
+		encoded, err := s.encodeLog(entry, tags, false)
+		if err != nil {
+			return "", err
+		}
+
+		if len(encoded) > maxEntryBytes {
+			l.Warn("audit log exceeds Datadog's entry size limit, dropping its metadata", "id", entry.AuditLog.ID, "bytes", len(encoded))
+
+			entry.AuditLog.Metadata = nil
+			if encoded, err = s.encodeLog(entry, tags, true); err != nil {
+				return "", err
+			}
+		}
+
+		// An entry that is still too large would be rejected on every run,
+		// and so block every later audit log
+		if len(encoded) > maxEntryBytes {
+			l.Error("audit log exceeds Datadog's entry size limit without its metadata, skipping", "id", entry.AuditLog.ID, "bytes", len(encoded))
+			continue
+		}
+
+		// +2 for the enclosing brackets, +1 for the separating comma
+		if len(batch) == maxEntriesPerPayload || (len(batch) > 0 && batchBytes+len(encoded)+len(batch)+2 > maxPayloadBytes) {
+			if err := flush(); err != nil {
+				return "", err
+			}
+		}
+
+		batch = append(batch, encoded)
+		batchBytes += len(encoded)
+	}
+
+	if err := flush(); err != nil {
+		return "", err
+	}
+
+	return s.intakeURL, nil
+}
+
+func (s *Sink) encodeLog(entry render.AuditLogEntry, tags string, truncated bool) ([]byte, error) {
+	encoded, err := json.Marshal(logEntry{
+		Source:    source,
+		Service:   s.opts.Service,
+		Tags:      tags,
+		Date:      entry.AuditLog.Timestamp,
+		Message:   fmt.Sprintf("%s %s by %s", entry.AuditLog.Event, entry.AuditLog.Status, actorName(entry.AuditLog.Actor)),
+		Cursor:    entry.Cursor,
+		AuditLog:  entry.AuditLog,
+		Truncated: truncated,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling log: %w", err)
+	}
+	return encoded, nil
+}
+
+func (s *Sink) tags(auditLogType auditlogs.LogType, id string) string {
+	tags := append([]string{
+		"log_type:" + string(auditLogType),
+		fmt.Sprintf("%s_id:%s", auditLogType, id),
+	}, s.opts.Tags...)
+
+	return strings.Join(tags, ",")
+}
+
+func actorName(actor render.Actor) string {
+	if actor.Email != "" {
+		return actor.Email
+	}
+	if actor.ID != "" {
+		return actor.ID
+	}
+	return actor.Type
+}
+
+// send posts a single payload, retrying transient failures
+func (s *Sink) send(ctx context.Context, payload []byte) error {
+	if s.opts.Gzip {
+		var err error
+		if payload, err = httpclient.Gzip(payload); err != nil {
+			return err
+		}
+	}
+
+	return retry.Do(ctx, s.opts.Retry, func() error {
+		return s.do(ctx, payload)
+	})
+}
+
+// do performs a single request
+func (s *Sink) do(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.intakeURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("DD-API-KEY", s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	if s.opts.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	_, err = httpclient.Send(s.httpClient, req)
+	return err
+}
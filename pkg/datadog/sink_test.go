@@ -0,0 +1,232 @@
+package datadog_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/datadog"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+type intakeLog struct {
+	Source   string    `json:"ddsource"`
+	Service  string    `json:"service"`
+	Tags     string    `json:"ddtags"`
+	Date     time.Time `json:"date"`
+	Message  string    `json:"message"`
+	Cursor   string    `json:"cursor"`
+	AuditLog struct {
+		ID       string            `json:"id"`
+		Metadata map[string]string `json:"metadata"`
+	} `json:"auditLog"`
+	Truncated bool `json:"truncated"`
+}
+
+// fakeIntake records the payloads accepted by the logs intake
+type fakeIntake struct {
+	mu           sync.Mutex
+	payloads     [][]intakeLog
+	payloadBytes []int
+	requests     int
+	failFirst    int
+	status       int
+}
+
+func (f *fakeIntake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	if f.requests <= f.failFirst {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		io.WriteString(w, `{"errors":[{"status":"403","title":"Forbidden"}]}`)
+		return
+	}
+	if r.Header.Get("DD-API-KEY") != "test-api-key" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = gz
+	}
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var logs []intakeLog
+	if err := json.Unmarshal(raw, &logs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.payloads = append(f.payloads, logs)
+	f.payloadBytes = append(f.payloadBytes, len(raw))
+	w.WriteHeader(http.StatusAccepted)
+	io.WriteString(w, "{}")
+}
+
+func TestUploadAuditLogs(t *testing.T) {
+	t.Parallel()
+
+	testDate := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	fastRetry := retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	t.Run("sends audit logs with source, service and tags", func(t *testing.T) {
+		t.Parallel()
+		intake := &fakeIntake{}
+		server := httptest.NewServer(intake)
+		defer server.Close()
+
+		testData := testhelpers.CreateTestAuditLogs(3, testDate)
+
+		sink, err := datadog.NewSink(server.Client(), server.URL, "test-api-key", datadog.SinkOptions{
+			Tags:  []string{"env:prod"},
+			Gzip:  true,
+			Retry: fastRetry,
+		})
+		require.NoError(t, err)
+
+		location, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+		require.Equal(t, server.URL, location)
+
+		require.Len(t, intake.payloads, 1)
+		logs := intake.payloads[0]
+		require.Len(t, logs, 3)
+		for i, l := range logs {
+			require.Equal(t, "render", l.Source)
+			require.Equal(t, "render-auditlogs", l.Service)
+			require.Equal(t, "log_type:workspace,workspace_id:tea-123,env:prod", l.Tags)
+			require.Equal(t, testData[i].AuditLog.Timestamp, l.Date)
+			require.Equal(t, testData[i].Cursor, l.Cursor)
+			require.Equal(t, testData[i].AuditLog.ID, l.AuditLog.ID)
+			require.Equal(t, "LoginEvent success by test@example.com", l.Message)
+		}
+	})
+
+	t.Run("splits batches at the entry count limit", func(t *testing.T) {
+		t.Parallel()
+		intake := &fakeIntake{}
+		server := httptest.NewServer(intake)
+		defer server.Close()
+
+		testData := testhelpers.CreateTestAuditLogs(1005, testDate)
+
+		sink, err := datadog.NewSink(server.Client(), server.URL, "test-api-key", datadog.SinkOptions{Retry: fastRetry})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.OrganizationAuditLog, "org-456", testData)
+		require.NoError(t, err)
+
+		require.Len(t, intake.payloads, 2)
+		require.Len(t, intake.payloads[0], 1000)
+		require.Len(t, intake.payloads[1], 5)
+		require.Equal(t, "log_type:organization,organization_id:org-456", intake.payloads[0][0].Tags)
+	})
+
+	t.Run("splits batches at the payload size limit", func(t *testing.T) {
+		t.Parallel()
+		intake := &fakeIntake{}
+		server := httptest.NewServer(intake)
+		defer server.Close()
+
+		testData := testhelpers.CreateTestAuditLogs(7, testDate)
+		for i := range testData {
+			testData[i].AuditLog.Metadata = map[string]string{"large": strings.Repeat("x", 900*1024)}
+		}
+
+		sink, err := datadog.NewSink(server.Client(), server.URL, "test-api-key", datadog.SinkOptions{Retry: fastRetry})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+
+		require.Len(t, intake.payloads, 2)
+		require.Len(t, intake.payloads[0], 5)
+		require.Len(t, intake.payloads[1], 2)
+		for _, size := range intake.payloadBytes {
+			require.LessOrEqual(t, size, 5*1024*1024)
+		}
+	})
+
+	t.Run("drops the metadata of entries over the size limit", func(t *testing.T) {
+		t.Parallel()
+		intake := &fakeIntake{}
+		server := httptest.NewServer(intake)
+		defer server.Close()
+
+		testData := testhelpers.CreateTestAuditLogs(2, testDate)
+		testData[0].AuditLog.Metadata = map[string]string{"large": strings.Repeat("x", 2*1024*1024)}
+
+		sink, err := datadog.NewSink(server.Client(), server.URL, "test-api-key", datadog.SinkOptions{Retry: fastRetry})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+
+		require.Len(t, intake.payloads, 1)
+		logs := intake.payloads[0]
+		require.Len(t, logs, 2)
+		require.True(t, logs[0].Truncated)
+		require.Empty(t, logs[0].AuditLog.Metadata)
+		require.Equal(t, testData[0].AuditLog.ID, logs[0].AuditLog.ID)
+		require.False(t, logs[1].Truncated)
+		require.Less(t, intake.payloadBytes[0], 1024*1024)
+	})
+
+	t.Run("retries server errors", func(t *testing.T) {
+		t.Parallel()
+		intake := &fakeIntake{failFirst: 2}
+		server := httptest.NewServer(intake)
+		defer server.Close()
+
+		sink, err := datadog.NewSink(server.Client(), server.URL, "test-api-key", datadog.SinkOptions{Retry: fastRetry})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(3, testDate))
+		require.NoError(t, err)
+		require.Equal(t, 3, intake.requests)
+		require.Len(t, intake.payloads, 1)
+	})
+
+	t.Run("returns error when logs are rejected", func(t *testing.T) {
+		t.Parallel()
+		intake := &fakeIntake{status: http.StatusForbidden}
+		server := httptest.NewServer(intake)
+		defer server.Close()
+
+		sink, err := datadog.NewSink(server.Client(), server.URL, "test-api-key", datadog.SinkOptions{Retry: fastRetry})
+		require.NoError(t, err)
+
+		location, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(3, testDate))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "403")
+		require.Empty(t, location)
+		require.Equal(t, 1, intake.requests)
+	})
+}
@@ -0,0 +1,260 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/httpclient"
+	"github.com/renderinc/render-auditlogs/pkg/logger"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+const (
+	bulkPath = "/_bulk"
+
+	defaultIndexPrefix = "render-audit"
+	defaultBatchSize   = 500
+	defaultTimeout     = 30 * time.Second
+)
+
+type SinkOptions struct {
+	// IndexPrefix is prepended to the daily index name,
+	// e.g. render-audit-workspace-2024.01.15
+	IndexPrefix string
+	// BatchSize is the maximum number of documents sent per bulk request
+	BatchSize int
+	// Username and Password enable basic authentication
+	Username string
+	Password string
+	// APIKey enables API key authentication, taking precedence over basic
+	// authentication
+	APIKey string
+	Retry  retry.Policy
+}
+
+// Sink indexes audit logs into Elasticsearch or OpenSearch with the bulk API
+type Sink struct {
+	httpClient *http.Client
+	baseURL    string
+	opts       SinkOptions
+}
+
+// document is the indexed representation of an audit log
+type document struct {
+	Timestamp time.Time       `json:"@timestamp"`
+	LogType   string          `json:"log_type"`
+	OwnerID   string          `json:"owner_id"`
+	Cursor    string          `json:"cursor"`
+	AuditLog  render.AuditLog `json:"auditLog"`
+}
+
+// bulkItem is a single document to index along with its bulk action line
+type bulkItem struct {
+	index string
+	id    string
+	doc   []byte
+}
+
+// bulkResponse is the body returned by the bulk API
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Index  string `json:"_index"`
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func NewSinkFromConfig(ctx context.Context, cfg *env.Config) (*Sink, error) {
+	if cfg.ElasticsearchURL == "" {
+		return nil, fmt.Errorf("ELASTICSEARCH_URL is required for the elasticsearch sink")
+	}
+
+	httpClient := &http.Client{Timeout: cfg.SinkRequestTimeout}
+
+	return NewSink(httpClient, cfg.ElasticsearchURL, SinkOptions{
+		IndexPrefix: cfg.ElasticsearchIndexPrefix,
+		BatchSize:   cfg.ElasticsearchBatchSize,
+		Username:    cfg.ElasticsearchUsername,
+		Password:    cfg.ElasticsearchPassword,
+		APIKey:      cfg.ElasticsearchAPIKey,
+		Retry: retry.Policy{
+			MaxAttempts:    cfg.SinkRetryMaxAttempts,
+			InitialBackoff: cfg.SinkRetryInitialBackoff,
+			MaxBackoff:     cfg.SinkRetryMaxBackoff,
+		},
+	})
+}
+
+func NewSink(httpClient *http.Client, baseURL string, opts SinkOptions) (*Sink, error) {
+	httpClient = httpclient.WithTimeout(httpClient, defaultTimeout)
+	if opts.IndexPrefix == "" {
+		opts.IndexPrefix = defaultIndexPrefix
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+
+	return &Sink{
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		opts:       opts,
+	}, nil
+}
+
+// UploadAuditLogs indexes each audit log into a daily index, using the audit
+// log ID as the document ID so that re-indexing a page is idempotent. Only the
+// documents that failed with a transient error are retried.
+func (s *Sink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	items := make([]bulkItem, 0, len(data))
+	for _, entry := range data {
+		doc, err := json.Marshal(document{
+			Timestamp: entry.AuditLog.Timestamp,
+			LogType:   string(auditLogType),
+			OwnerID:   id,
+			Cursor:    entry.Cursor,
+			AuditLog:  entry.AuditLog,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error marshaling document: %w", err)
+		}
+
+		items = append(items, bulkItem{
+			index: s.indexName(auditLogType, entry.AuditLog.Timestamp),
+			id:    entry.AuditLog.ID,
+			doc:   doc,
+		})
+	}
+
+	for start := 0; start < len(items); start += s.opts.BatchSize {
+		end := min(start+s.opts.BatchSize, len(items))
+
+		if err := s.bulk(ctx, items[start:end]); err != nil {
+			return "", fmt.Errorf("error indexing audit logs: %w", err)
+		}
+	}
+
+	return fmt.Sprintf("%s/%s-%s-*", s.baseURL, s.opts.IndexPrefix, auditLogType), nil
+}
+
+func (s *Sink) indexName(auditLogType auditlogs.LogType, t time.Time) string {
+	return fmt.Sprintf("%s-%s-%s", s.opts.IndexPrefix, auditLogType, t.UTC().Format("2006.01.02"))
+}
+
+// bulk indexes items, retrying the whole request on transient failures and
+// resending only the items that were rejected with a transient status
+func (s *Sink) bulk(ctx context.Context, items []bulkItem) error {
+	l := logger.FromContext(ctx)
+	pending := items
+
+	return retry.Do(ctx, s.opts.Retry, func() error {
+		body, err := encodeBulk(pending)
+		if err != nil {
+			return err
+		}
+
+		var resp bulkResponse
+		if err := s.do(ctx, body, &resp); err != nil {
+			return err
+		}
+
+		if !resp.Errors {
+			return nil
+		}
+
+		if len(resp.Items) != len(pending) {
+			return fmt.Errorf("bulk response has %d items, expected %d", len(resp.Items), len(pending))
+		}
+
+		var failed []bulkItem
+		var lastErr string
+		for i, result := range resp.Items {
+			for _, r := range result {
+				if r.Status >= 200 && r.Status < 300 {
+					continue
+				}
+
+				reason := fmt.Sprintf("status %d", r.Status)
+				if r.Error != nil {
+					reason = fmt.Sprintf("%s: %s", r.Error.Type, r.Error.Reason)
+				}
+
+				if !retry.IsRetryableStatus(r.Status) {
+					return fmt.Errorf("document %s in %s was rejected: %s", r.ID, r.Index, reason)
+				}
+
+				failed = append(failed, pending[i])
+				lastErr = reason
+			}
+		}
+
+		if len(failed) == 0 {
+			return nil
+		}
+
+		l.Warn("some documents failed to index", "failed", len(failed), "total", len(pending))
+		pending = failed
+
+		return retry.Retryable(fmt.Errorf("%d documents failed to index, last error: %s", len(failed), lastErr), 0)
+	})
+}
+
+// encodeBulk builds an NDJSON bulk request body
+func encodeBulk(items []bulkItem) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, item := range items {
+		action, err := json.Marshal(map[string]map[string]string{
+			"index": {"_index": item.index, "_id": item.id},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling bulk action: %w", err)
+		}
+
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(item.doc)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// do performs a single bulk request
+func (s *Sink) do(ctx context.Context, body []byte, out *bulkResponse) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+bulkPath, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case s.opts.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.opts.APIKey)
+	case s.opts.Username != "":
+		req.SetBasicAuth(s.opts.Username, s.opts.Password)
+	}
+
+	respBody, err := httpclient.Send(s.httpClient, req)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("error parsing bulk response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package elasticsearch_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/elasticsearch"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+type indexedDocument struct {
+	Timestamp time.Time `json:"@timestamp"`
+	LogType   string    `json:"log_type"`
+	OwnerID   string    `json:"owner_id"`
+	Cursor    string    `json:"cursor"`
+	AuditLog  struct {
+		ID string `json:"id"`
+	} `json:"auditLog"`
+}
+
+// fakeCluster implements the bulk API, rejecting documents according to
+// rejectWith until they have been attempted rejectTimes times
+type fakeCluster struct {
+	mu          sync.Mutex
+	docs        map[string]map[string]indexedDocument
+	requests    int
+	attempts    map[string]int
+	rejectWith  map[string]int
+	rejectTimes int
+	authHeader  string
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{
+		docs:       map[string]map[string]indexedDocument{},
+		attempts:   map[string]int{},
+		rejectWith: map[string]int{},
+	}
+}
+
+func (f *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	f.authHeader = r.Header.Get("Authorization")
+
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	type result struct {
+		Index  string `json:"_index"`
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  any    `json:"error,omitempty"`
+	}
+
+	var items []map[string]result
+	hasErrors := false
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !scanner.Scan() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var doc indexedDocument
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		meta := action["index"]
+		f.attempts[meta.ID]++
+
+		if status, ok := f.rejectWith[meta.ID]; ok && f.attempts[meta.ID] <= f.rejectTimes {
+			hasErrors = true
+			items = append(items, map[string]result{"index": {
+				Index:  meta.Index,
+				ID:     meta.ID,
+				Status: status,
+				Error:  map[string]string{"type": "rejected_execution_exception", "reason": "rejected"},
+			}})
+			continue
+		}
+
+		if f.docs[meta.Index] == nil {
+			f.docs[meta.Index] = map[string]indexedDocument{}
+		}
+		f.docs[meta.Index][meta.ID] = doc
+		items = append(items, map[string]result{"index": {Index: meta.Index, ID: meta.ID, Status: http.StatusCreated}})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"took": 1, "errors": hasErrors, "items": items})
+}
+
+func (f *fakeCluster) count() int {
+	n := 0
+	for _, docs := range f.docs {
+		n += len(docs)
+	}
+	return n
+}
+
+func TestUploadAuditLogs(t *testing.T) {
+	t.Parallel()
+
+	testDate := time.Date(2024, 1, 15, 23, 0, 0, 0, time.UTC)
+	fastRetry := retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	t.Run("indexes into daily indices keyed by audit log ID", func(t *testing.T) {
+		t.Parallel()
+		cluster := newFakeCluster()
+		server := httptest.NewServer(cluster)
+		defer server.Close()
+
+		// spans midnight, so documents land in two daily indices
+		testData := testhelpers.CreateTestAuditLogs(90, testDate)
+
+		sink, err := elasticsearch.NewSink(server.Client(), server.URL, elasticsearch.SinkOptions{
+			BatchSize: 25,
+			APIKey:    "test-key",
+			Retry:     fastRetry,
+		})
+		require.NoError(t, err)
+
+		location, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+		require.Equal(t, server.URL+"/render-audit-workspace-*", location)
+		require.Equal(t, 4, cluster.requests)
+		require.Equal(t, "ApiKey test-key", cluster.authHeader)
+
+		require.Len(t, cluster.docs["render-audit-workspace-2024.01.15"], 60)
+		require.Len(t, cluster.docs["render-audit-workspace-2024.01.16"], 30)
+
+		doc := cluster.docs["render-audit-workspace-2024.01.15"][testData[0].AuditLog.ID]
+		require.Equal(t, testData[0].AuditLog.ID, doc.AuditLog.ID)
+		require.Equal(t, testData[0].Cursor, doc.Cursor)
+		require.Equal(t, testData[0].AuditLog.Timestamp, doc.Timestamp)
+		require.Equal(t, "workspace", doc.LogType)
+		require.Equal(t, "tea-123", doc.OwnerID)
+	})
+
+	t.Run("re-indexing the same audit logs is idempotent", func(t *testing.T) {
+		t.Parallel()
+		cluster := newFakeCluster()
+		server := httptest.NewServer(cluster)
+		defer server.Close()
+
+		testData := testhelpers.CreateTestAuditLogs(10, testDate)
+
+		sink, err := elasticsearch.NewSink(server.Client(), server.URL, elasticsearch.SinkOptions{
+			IndexPrefix: "audit",
+			Retry:       fastRetry,
+		})
+		require.NoError(t, err)
+
+		for range 2 {
+			_, err = sink.UploadAuditLogs(t.Context(), auditlogs.OrganizationAuditLog, "org-456", testData)
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, 10, cluster.count())
+		require.Len(t, cluster.docs["audit-organization-2024.01.15"], 10)
+	})
+
+	t.Run("retries only the documents that failed", func(t *testing.T) {
+		t.Parallel()
+		cluster := newFakeCluster()
+		server := httptest.NewServer(cluster)
+		defer server.Close()
+
+		testData := testhelpers.CreateTestAuditLogs(10, testDate)
+		cluster.rejectTimes = 1
+		cluster.rejectWith[testData[3].AuditLog.ID] = http.StatusTooManyRequests
+		cluster.rejectWith[testData[7].AuditLog.ID] = http.StatusServiceUnavailable
+
+		sink, err := elasticsearch.NewSink(server.Client(), server.URL, elasticsearch.SinkOptions{Retry: fastRetry})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+
+		require.Equal(t, 2, cluster.requests)
+		require.Equal(t, 10, cluster.count())
+		for i, entry := range testData {
+			want := 1
+			if i == 3 || i == 7 {
+				want = 2
+			}
+			require.Equal(t, want, cluster.attempts[entry.AuditLog.ID], fmt.Sprintf("attempts for entry %d", i))
+		}
+	})
+
+	t.Run("returns error when documents keep failing", func(t *testing.T) {
+		t.Parallel()
+		cluster := newFakeCluster()
+		server := httptest.NewServer(cluster)
+		defer server.Close()
+
+		testData := testhelpers.CreateTestAuditLogs(5, testDate)
+		cluster.rejectTimes = 10
+		cluster.rejectWith[testData[2].AuditLog.ID] = http.StatusTooManyRequests
+
+		sink, err := elasticsearch.NewSink(server.Client(), server.URL, elasticsearch.SinkOptions{Retry: fastRetry})
+		require.NoError(t, err)
+
+		location, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "1 documents failed to index")
+		require.Empty(t, location)
+		require.Equal(t, 3, cluster.requests)
+	})
+
+	t.Run("does not retry rejected documents", func(t *testing.T) {
+		t.Parallel()
+		cluster := newFakeCluster()
+		server := httptest.NewServer(cluster)
+		defer server.Close()
+
+		testData := testhelpers.CreateTestAuditLogs(5, testDate)
+		cluster.rejectTimes = 10
+		cluster.rejectWith[testData[1].AuditLog.ID] = http.StatusBadRequest
+
+		sink, err := elasticsearch.NewSink(server.Client(), server.URL, elasticsearch.SinkOptions{
+			Username: "elastic",
+			Password: "changeme",
+			Retry:    fastRetry,
+		})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), testData[1].AuditLog.ID)
+		require.Equal(t, 1, cluster.requests)
+		require.Contains(t, cluster.authHeader, "Basic ")
+	})
+}
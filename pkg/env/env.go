@@ -3,6 +3,7 @@ package env
 import (
 	"context"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
@@ -13,16 +14,128 @@ import (
 )
 
 type Config struct {
+	// Sink selects where audit logs are written, see pkg/sink
+	Sink string `default:"s3"`
+	// CheckpointStore selects where checkpoints are stored, defaulting to Sink
+	CheckpointStore string `required:"false" split_words:"true"`
+
 	WorkspaceIDS       []string `required:"true" split_words:"true"`
 	OrganizationID     string   `required:"false" split_words:"true"`
-	S3Bucket           string   `required:"true" split_words:"true"`
+	S3Bucket           string   `required:"false" split_words:"true"`
 	S3BucketKeyEnabled bool     `required:"false" split_words:"true"`
 	S3KMSKeyID         string   `required:"false" split_words:"true"`
 	S3UseKMS           bool     `required:"false" split_words:"true"`
+	S3Endpoint         string   `required:"false" split_words:"true"`
+	S3UsePathStyle     bool     `required:"false" split_words:"true"`
+	S3DisableSSE       bool     `required:"false" split_words:"true"`
 	RenderAPIKey       string   `required:"true" split_words:"true"`
-	AWSAccessKeyID     string   `required:"true" split_words:"true"`
-	AWSSecretAccessKey string   `required:"true" split_words:"true"`
-	AWSRegion          string   `required:"true" split_words:"true"`
+	AWSAccessKeyID     string   `required:"false" split_words:"true"`
+	AWSSecretAccessKey string   `required:"false" split_words:"true"`
+	AWSRegion          string   `required:"false" split_words:"true"`
+
+	// S3NotifySQSQueueURL and S3NotifySNSTopicARN receive a manifest of every
+	// object written by the s3 sink
+	S3NotifySQSQueueURL string `envconfig:"S3_NOTIFY_SQS_QUEUE_URL" required:"false"`
+	S3NotifySNSTopicARN string `envconfig:"S3_NOTIFY_SNS_TOPIC_ARN" required:"false"`
+
+	// ObjectFormat is the encoding of the objects written by the s3, gcs,
+	// azure and filesystem sinks, json, ndjson or parquet
+	ObjectFormat             string `default:"json" split_words:"true"`
+	ObjectCompression        string `default:"gzip" split_words:"true"`
+	ObjectGzipLevel          int    `required:"false" split_words:"true"`
+	ObjectContentEncoding    bool   `required:"false" split_words:"true"`
+	ObjectParquetCompression string `default:"snappy" split_words:"true"`
+	ObjectPartition          string `default:"day" split_words:"true"`
+	ObjectZeroPadPartitions  bool   `required:"false" split_words:"true"`
+	ObjectKeyPrefix          string `required:"false" split_words:"true"`
+	ObjectKeyTemplate        string `required:"false" split_words:"true"`
+
+	FilesystemRoot string `required:"false" split_words:"true"`
+
+	GCSBucket                string `required:"false" split_words:"true"`
+	GCSKMSKeyName            string `envconfig:"GCS_KMS_KEY_NAME" required:"false"`
+	GCSEndpoint              string `required:"false" split_words:"true"`
+	GCSWithoutAuthentication bool   `required:"false" split_words:"true"`
+
+	AzureStorageContainer        string `required:"false" split_words:"true"`
+	AzureStorageAccountURL       string `required:"false" split_words:"true"`
+	AzureStorageConnectionString string `required:"false" split_words:"true"`
+	AzureStorageEncryptionKey    string `required:"false" split_words:"true"`
+	AzureStorageEncryptionScope  string `required:"false" split_words:"true"`
+
+	SplunkHECURL     string        `envconfig:"SPLUNK_HEC_URL" required:"false"`
+	SplunkHECToken   string        `envconfig:"SPLUNK_HEC_TOKEN" required:"false"`
+	SplunkIndex      string        `required:"false" split_words:"true"`
+	SplunkSourcetype string        `required:"false" split_words:"true"`
+	SplunkSource     string        `required:"false" split_words:"true"`
+	SplunkBatchSize  int           `default:"100" split_words:"true"`
+	SplunkGzip       bool          `required:"false" split_words:"true"`
+	SplunkAckChannel string        `required:"false" split_words:"true"`
+	SplunkAckTimeout time.Duration `default:"2m" split_words:"true"`
+
+	DatadogAPIKey    string   `envconfig:"DATADOG_API_KEY" required:"false"`
+	DatadogSite      string   `default:"datadoghq.com" split_words:"true"`
+	DatadogIntakeURL string   `envconfig:"DATADOG_INTAKE_URL" required:"false"`
+	DatadogService   string   `required:"false" split_words:"true"`
+	DatadogTags      []string `required:"false" split_words:"true"`
+	DatadogGzip      bool     `default:"true" split_words:"true"`
+
+	ElasticsearchURL         string `envconfig:"ELASTICSEARCH_URL" required:"false"`
+	ElasticsearchUsername    string `required:"false" split_words:"true"`
+	ElasticsearchPassword    string `required:"false" split_words:"true"`
+	ElasticsearchAPIKey      string `envconfig:"ELASTICSEARCH_API_KEY" required:"false"`
+	ElasticsearchIndexPrefix string `default:"render-audit" split_words:"true"`
+	ElasticsearchBatchSize   int    `default:"500" split_words:"true"`
+
+	KafkaBrokers            []string `required:"false" split_words:"true"`
+	KafkaTopic              string   `required:"false" split_words:"true"`
+	KafkaClientID           string   `envconfig:"KAFKA_CLIENT_ID" required:"false"`
+	KafkaCompression        string   `default:"snappy" split_words:"true"`
+	KafkaDisableIdempotence bool     `required:"false" split_words:"true"`
+	KafkaSASLMechanism      string   `envconfig:"KAFKA_SASL_MECHANISM" required:"false"`
+	KafkaSASLUsername       string   `envconfig:"KAFKA_SASL_USERNAME" required:"false"`
+	KafkaSASLPassword       string   `envconfig:"KAFKA_SASL_PASSWORD" required:"false"`
+	KafkaTLS                bool     `envconfig:"KAFKA_TLS" required:"false"`
+	KafkaTLSCAFile          string   `envconfig:"KAFKA_TLS_CA_FILE" required:"false"`
+
+	SyslogAddress      string `required:"false" split_words:"true"`
+	SyslogNetwork      string `default:"tcp" split_words:"true"`
+	SyslogHostname     string `required:"false" split_words:"true"`
+	SyslogAppName      string `required:"false" split_words:"true"`
+	SyslogFacility     int    `default:"16" split_words:"true"`
+	SyslogEnterpriseID string `envconfig:"SYSLOG_ENTERPRISE_ID" required:"false"`
+	SyslogTLSCAFile    string `envconfig:"SYSLOG_TLS_CA_FILE" required:"false"`
+
+	WebhookURL       string            `envconfig:"WEBHOOK_URL" required:"false"`
+	WebhookSecret    string            `required:"false" split_words:"true"`
+	WebhookHeaders   map[string]string `required:"false" split_words:"true"`
+	WebhookBatchSize int               `default:"100" split_words:"true"`
+
+	CloudWatchLogGroup       string `envconfig:"CLOUDWATCH_LOG_GROUP" required:"false"`
+	CloudWatchCreateLogGroup bool   `envconfig:"CLOUDWATCH_CREATE_LOG_GROUP" required:"false"`
+
+	FirehoseDeliveryStream string `required:"false" split_words:"true"`
+	KinesisStreamName      string `required:"false" split_words:"true"`
+
+	PostgresURL string `envconfig:"POSTGRES_URL" required:"false"`
+
+	OTLPEndpoint    string            `required:"false" split_words:"true"`
+	OTLPProtocol    string            `default:"grpc" split_words:"true"`
+	OTLPHeaders     map[string]string `required:"false" split_words:"true"`
+	OTLPInsecure    bool              `required:"false" split_words:"true"`
+	OTLPServiceName string            `default:"render-auditlogs" split_words:"true"`
+	OTLPBatchSize   int               `default:"512" split_words:"true"`
+
+	// Timeout and retry policy for sinks that send audit logs over HTTP
+	SinkRequestTimeout      time.Duration `default:"30s" split_words:"true"`
+	SinkRetryMaxAttempts    int           `default:"4" split_words:"true"`
+	SinkRetryInitialBackoff time.Duration `default:"1s" split_words:"true"`
+	SinkRetryMaxBackoff     time.Duration `default:"30s" split_words:"true"`
+
+	RenderRequestTimeout      time.Duration `default:"5s" split_words:"true"`
+	RenderRetryMaxAttempts    int           `default:"4" split_words:"true"`
+	RenderRetryInitialBackoff time.Duration `default:"500ms" split_words:"true"`
+	RenderRetryMaxBackoff     time.Duration `default:"30s" split_words:"true"`
 
 	AWSConfig aws.Config
 }
@@ -0,0 +1,47 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/renderinc/render-auditlogs/pkg/archive"
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+)
+
+// LoadCheckpoint reads the checkpoint from disk. Returns nil if file doesn't exist.
+func (s *Sink) LoadCheckpoint(ctx context.Context, logType auditlogs.LogType, id string) (*checkpoint.Checkpoint, error) {
+	data, err := os.ReadFile(s.path(archive.CheckpointKey(logType, id)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// No checkpoint file exists yet, return nil
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading checkpoint file: %w", err)
+	}
+
+	var cp checkpoint.Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("error unmarshaling checkpoint: %w", err)
+	}
+
+	return &cp, nil
+}
+
+// SaveCheckpoint atomically writes the checkpoint to disk
+func (s *Sink) SaveCheckpoint(ctx context.Context, cp *checkpoint.Checkpoint, logType auditlogs.LogType, id string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling checkpoint: %w", err)
+	}
+
+	if err := writeFileAtomic(s.path(archive.CheckpointKey(logType, id)), data); err != nil {
+		return fmt.Errorf("error writing checkpoint file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package filesystem_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+	"github.com/renderinc/render-auditlogs/pkg/filesystem"
+)
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+	testTime := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	t.Run("returns nil when checkpoint does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		sink, err := filesystem.NewSink(t.TempDir())
+		require.NoError(t, err)
+
+		cp, err := sink.LoadCheckpoint(t.Context(), auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+		require.Nil(t, cp)
+	})
+
+	t.Run("saves and loads checkpoint", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+
+		sink, err := filesystem.NewSink(root)
+		require.NoError(t, err)
+
+		want := &checkpoint.Checkpoint{
+			LastCursor:    "test-cursor-456",
+			LastTimestamp: testTime,
+		}
+
+		err = sink.SaveCheckpoint(t.Context(), want, auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(root, "workspace=test-workspace", "checkpoint.json"))
+
+		cp, err := sink.LoadCheckpoint(t.Context(), auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+		require.Equal(t, want, cp)
+	})
+
+	t.Run("returns error on invalid JSON", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+
+		sink, err := filesystem.NewSink(root)
+		require.NoError(t, err)
+
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "workspace=test-workspace"), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "workspace=test-workspace", "checkpoint.json"), []byte("invalid json"), 0o600))
+
+		cp, err := sink.LoadCheckpoint(t.Context(), auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.Error(t, err)
+		require.Nil(t, cp)
+		require.Contains(t, err.Error(), "error unmarshaling checkpoint")
+	})
+}
@@ -0,0 +1,136 @@
+package filesystem
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/renderinc/render-auditlogs/pkg/archive"
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+const (
+	dirPerm  os.FileMode = 0o750
+	filePerm os.FileMode = 0o640
+)
+
+type SinkOptions struct {
+	// Archive controls how files are encoded
+	Archive archive.Options
+}
+
+// Sink writes audit logs and checkpoints to a local directory using the same
+// partitioned layout as the S3 uploader
+type Sink struct {
+	root string
+	opts SinkOptions
+}
+
+// NewSinkFromConfig creates a sink rooted at cfg.FilesystemRoot
+func NewSinkFromConfig(ctx context.Context, cfg *env.Config) (*Sink, error) {
+	if cfg.FilesystemRoot == "" {
+		return nil, fmt.Errorf("FILESYSTEM_ROOT is required for the filesystem sink")
+	}
+
+	archiveOpts, err := archive.OptionsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSinkWithOptions(cfg.FilesystemRoot, SinkOptions{Archive: archiveOpts})
+}
+
+func NewSink(root string) (*Sink, error) {
+	return NewSinkWithOptions(root, SinkOptions{})
+}
+
+func NewSinkWithOptions(root string, opts SinkOptions) (*Sink, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving root directory: %w", err)
+	}
+
+	if err := os.MkdirAll(root, dirPerm); err != nil {
+		return nil, fmt.Errorf("error creating root directory: %w", err)
+	}
+
+	return &Sink{root: root, opts: opts}, nil
+}
+
+// UploadAuditLogs writes audit logs to a file under the root directory
+// Path format: see archive.generateKey
+func (s *Sink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	obj, err := archive.NewObject(auditLogType, id, data, s.opts.Archive)
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsLocal(filepath.FromSlash(obj.Key)) {
+		return "", fmt.Errorf("object key %q is outside the root directory", obj.Key)
+	}
+
+	path := s.path(obj.Key)
+	if err := writeFileAtomic(path, obj.Body); err != nil {
+		return "", fmt.Errorf("error writing audit logs file: %w", err)
+	}
+
+	return path, nil
+}
+
+func (s *Sink) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// writeFileAtomic writes data to a temporary file in the target directory,
+// fsyncs it and renames it into place, so readers never observe a partially
+// written file. The directory is fsynced afterwards so the rename itself
+// survives a crash.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Clean up the temporary file on any failure; after a successful rename
+	// this is a no-op
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(filePerm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,109 @@
+package filesystem_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/archive"
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/filesystem"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+func TestUploadAuditLogs(t *testing.T) {
+	t.Parallel()
+
+	testData := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+
+	t.Run("writes audit logs using the partitioned layout", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+
+		sink, err := filesystem.NewSink(root)
+		require.NoError(t, err)
+
+		path, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+
+		rel, err := filepath.Rel(root, path)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(filepath.ToSlash(rel), "workspace=workspace-123/year=2024/month=1/day=15/audit-logs-2024-01-15"))
+		require.True(t, strings.HasSuffix(path, ".json.gz"))
+
+		body, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		gzReader, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		defer gzReader.Close()
+
+		decompressed, err := io.ReadAll(gzReader)
+		require.NoError(t, err)
+
+		var uploadedData []render.AuditLogEntry
+		require.NoError(t, json.Unmarshal(decompressed, &uploadedData))
+		require.Equal(t, testData, uploadedData)
+	})
+
+	t.Run("keeps event names within the root", func(t *testing.T) {
+		t.Parallel()
+		root := filepath.Join(t.TempDir(), "root")
+
+		sink, err := filesystem.NewSinkWithOptions(root, filesystem.SinkOptions{
+			Archive: archive.Options{KeyTemplate: "{event}/{batch}"},
+		})
+		require.NoError(t, err)
+
+		data := testhelpers.CreateTestAuditLogs(1, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+		data[0].AuditLog.Event = "../../escaped"
+
+		path, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", data)
+		require.NoError(t, err)
+
+		rel, err := filepath.Rel(root, path)
+		require.NoError(t, err)
+		require.True(t, filepath.IsLocal(rel))
+	})
+
+	t.Run("leaves no temporary files behind", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+
+		sink, err := filesystem.NewSink(root)
+		require.NoError(t, err)
+
+		path, err := sink.UploadAuditLogs(t.Context(), auditlogs.OrganizationAuditLog, "org-456", testData)
+		require.NoError(t, err)
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, filepath.Base(path), entries[0].Name())
+	})
+
+	t.Run("returns error when the directory is not writable", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+
+		sink, err := filesystem.NewSink(root)
+		require.NoError(t, err)
+
+		// a file where the partition directory should be
+		require.NoError(t, os.WriteFile(filepath.Join(root, "workspace=workspace-123"), nil, 0o600))
+
+		path, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "error writing audit logs file")
+		require.Empty(t, path)
+	})
+}
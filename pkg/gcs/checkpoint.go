@@ -0,0 +1,44 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/renderinc/render-auditlogs/pkg/archive"
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+)
+
+// LoadCheckpoint reads the checkpoint from GCS. Returns nil if object doesn't exist.
+func (u *Uploader) LoadCheckpoint(ctx context.Context, logType auditlogs.LogType, id string) (*checkpoint.Checkpoint, error) {
+	data, err := u.getObject(ctx, archive.CheckpointKey(logType, id))
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint from GCS: %w", err)
+	}
+	if data == nil {
+		// No checkpoint object exists yet, return nil
+		return nil, nil
+	}
+
+	var cp checkpoint.Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("error unmarshaling checkpoint: %w", err)
+	}
+
+	return &cp, nil
+}
+
+// SaveCheckpoint writes the checkpoint to GCS
+func (u *Uploader) SaveCheckpoint(ctx context.Context, cp *checkpoint.Checkpoint, logType auditlogs.LogType, id string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling checkpoint: %w", err)
+	}
+
+	if err := u.putObject(ctx, archive.CheckpointKey(logType, id), "application/json", "", data); err != nil {
+		return fmt.Errorf("error writing checkpoint to GCS: %w", err)
+	}
+
+	return nil
+}
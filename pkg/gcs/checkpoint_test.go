@@ -0,0 +1,66 @@
+package gcs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+	"github.com/renderinc/render-auditlogs/pkg/gcs"
+)
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+	testTime := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	t.Run("returns nil when checkpoint does not exist", func(t *testing.T) {
+		t.Parallel()
+		_, server := newFakeGCS(t, "test-bucket")
+
+		uploader, err := gcs.NewUploader(t.Context(), server.Client(), "test-bucket", gcs.UploaderOptions{Endpoint: server.URL})
+		require.NoError(t, err)
+
+		cp, err := uploader.LoadCheckpoint(t.Context(), auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+		require.Nil(t, cp)
+	})
+
+	t.Run("saves and loads checkpoint", func(t *testing.T) {
+		t.Parallel()
+		fake, server := newFakeGCS(t, "test-bucket")
+
+		uploader, err := gcs.NewUploader(t.Context(), server.Client(), "test-bucket", gcs.UploaderOptions{Endpoint: server.URL})
+		require.NoError(t, err)
+
+		want := &checkpoint.Checkpoint{
+			LastCursor:    "test-cursor-456",
+			LastTimestamp: testTime,
+		}
+
+		err = uploader.SaveCheckpoint(t.Context(), want, auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+
+		obj, ok := fake.object("workspace=test-workspace/checkpoint.json")
+		require.True(t, ok)
+		require.Equal(t, "application/json", obj.contentType)
+
+		cp, err := uploader.LoadCheckpoint(t.Context(), auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.NoError(t, err)
+		require.Equal(t, want, cp)
+	})
+
+	t.Run("returns error on GCS error", func(t *testing.T) {
+		t.Parallel()
+		fake, server := newFakeGCS(t, "test-bucket")
+		fake.failPuts = true
+
+		uploader, err := gcs.NewUploader(t.Context(), server.Client(), "test-bucket", gcs.UploaderOptions{Endpoint: server.URL})
+		require.NoError(t, err)
+
+		err = uploader.SaveCheckpoint(t.Context(), &checkpoint.Checkpoint{LastCursor: "c", LastTimestamp: testTime}, auditlogs.WorkspaceAuditLog, "test-workspace")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "error writing checkpoint to GCS")
+	})
+}
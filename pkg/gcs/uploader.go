@@ -0,0 +1,202 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+
+	"github.com/renderinc/render-auditlogs/pkg/archive"
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+const (
+	defaultEndpoint = "https://storage.googleapis.com"
+	readWriteScope  = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+type UploaderOptions struct {
+	// KMSKeyName is the Cloud KMS key used to encrypt objects (CMEK). When
+	// empty, the bucket's default encryption applies.
+	KMSKeyName string
+	// Endpoint overrides the GCS API endpoint, e.g. for an emulator
+	Endpoint string
+	// Archive controls how objects are encoded
+	Archive archive.Options
+}
+
+// Uploader writes audit logs and checkpoints to a GCS bucket through the JSON
+// API
+type Uploader struct {
+	httpClient *http.Client
+	bucket     string
+	opts       UploaderOptions
+}
+
+// NewUploaderFromConfig creates an uploader for the bucket and encryption
+// settings in cfg, authenticating with Application Default Credentials
+func NewUploaderFromConfig(ctx context.Context, cfg *env.Config) (*Uploader, error) {
+	if cfg.GCSBucket == "" {
+		return nil, fmt.Errorf("GCS_BUCKET is required for the gcs sink")
+	}
+
+	archiveOpts, err := archive.OptionsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{}
+	if !cfg.GCSWithoutAuthentication {
+		var err error
+		httpClient, err = google.DefaultClient(ctx, readWriteScope)
+		if err != nil {
+			return nil, fmt.Errorf("error loading GCS credentials: %w", err)
+		}
+	}
+	// Bound every request so a hung endpoint can't block the worker
+	httpClient.Timeout = cfg.SinkRequestTimeout
+
+	return NewUploader(ctx, httpClient, cfg.GCSBucket, UploaderOptions{
+		KMSKeyName: cfg.GCSKMSKeyName,
+		Endpoint:   cfg.GCSEndpoint,
+		Archive:    archiveOpts,
+	})
+}
+
+func NewUploader(ctx context.Context, httpClient *http.Client, bucket string, opts UploaderOptions) (*Uploader, error) {
+	if opts.Endpoint == "" {
+		opts.Endpoint = defaultEndpoint
+	}
+	opts.Endpoint = strings.TrimSuffix(opts.Endpoint, "/")
+
+	return &Uploader{
+		httpClient: httpClient,
+		bucket:     bucket,
+		opts:       opts,
+	}, nil
+}
+
+// UploadAuditLogs uploads audit logs to GCS with partitioned path structure
+// Path format: see archive.generateKey
+func (u *Uploader) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	obj, err := archive.NewObject(auditLogType, id, data, u.opts.Archive)
+	if err != nil {
+		return "", err
+	}
+
+	if err := u.putObject(ctx, obj.Key, obj.ContentType, obj.ContentEncoding, obj.Body); err != nil {
+		return "", fmt.Errorf("error uploading to GCS: %w", err)
+	}
+
+	gsURI := fmt.Sprintf("gs://%s/%s", u.bucket, obj.Key)
+	return gsURI, nil
+}
+
+// objectMetadata is the subset of the GCS object resource set on upload
+type objectMetadata struct {
+	Name            string `json:"name"`
+	ContentType     string `json:"contentType"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	KMSKeyName      string `json:"kmsKeyName,omitempty"`
+}
+
+// putObject performs a multipart upload of a single object
+func (u *Uploader) putObject(ctx context.Context, key, contentType, contentEncoding string, body []byte) error {
+	metadata, err := json.Marshal(objectMetadata{
+		Name:            key,
+		ContentType:     contentType,
+		ContentEncoding: contentEncoding,
+		KMSKeyName:      u.opts.KMSKeyName,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling object metadata: %w", err)
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(metadata); err != nil {
+		return err
+	}
+
+	part, err = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(body); err != nil {
+		return err
+	}
+
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	q := url.Values{"uploadType": {"multipart"}}
+	if u.opts.KMSKeyName != "" {
+		q.Set("kmsKeyName", u.opts.KMSKeyName)
+	}
+
+	reqURL := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", u.opts.Endpoint, url.PathEscape(u.bucket), q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, &buf)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "multipart/related; boundary="+mw.Boundary())
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newRequestError(resp)
+	}
+
+	return nil
+}
+
+// getObject downloads a single object. Returns nil if the object doesn't exist.
+func (u *Uploader) getObject(ctx context.Context, key string) ([]byte, error) {
+	reqURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", u.opts.Endpoint, url.PathEscape(u.bucket), url.PathEscape(key))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newRequestError(resp)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func newRequestError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("GCS request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
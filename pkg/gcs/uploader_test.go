@@ -0,0 +1,198 @@
+package gcs_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/gcs"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+type fakeObject struct {
+	contentType string
+	kmsKeyName  string
+	body        []byte
+}
+
+// fakeGCS implements the subset of the GCS JSON API used by the uploader
+type fakeGCS struct {
+	mu       sync.Mutex
+	bucket   string
+	objects  map[string]fakeObject
+	failPuts bool
+}
+
+func newFakeGCS(t *testing.T, bucket string) (*fakeGCS, *httptest.Server) {
+	f := &fakeGCS{bucket: bucket, objects: map[string]fakeObject{}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/"+f.bucket+"/o":
+		if f.failPuts {
+			http.Error(w, `{"error":{"code":503,"message":"backend error"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		f.upload(w, r)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/storage/v1/b/"+f.bucket+"/o/"):
+		name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/"+f.bucket+"/o/")
+		obj, ok := f.objects[name]
+		if !ok || r.URL.Query().Get("alt") != "media" {
+			http.Error(w, `{"error":{"code":404,"message":"No such object"}}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Write(obj.body)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func (f *fakeGCS) upload(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("uploadType") != "multipart" {
+		http.Error(w, "unsupported upload type", http.StatusBadRequest)
+		return
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/related" {
+		http.Error(w, "expected multipart/related", http.StatusBadRequest)
+		return
+	}
+
+	mr := multipart.NewReader(r.Body, params["boundary"])
+
+	metaPart, err := mr.NextPart()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var metadata struct {
+		Name        string `json:"name"`
+		ContentType string `json:"contentType"`
+		KMSKeyName  string `json:"kmsKeyName"`
+	}
+	if err := json.NewDecoder(metaPart).Decode(&metadata); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mediaPart, err := mr.NextPart()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(mediaPart)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	kmsKeyName := metadata.KMSKeyName
+	if q := r.URL.Query().Get("kmsKeyName"); q != "" {
+		kmsKeyName = q
+	}
+
+	f.objects[metadata.Name] = fakeObject{
+		contentType: mediaPart.Header.Get("Content-Type"),
+		kmsKeyName:  kmsKeyName,
+		body:        body,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"bucket": f.bucket, "name": metadata.Name})
+}
+
+func (f *fakeGCS) object(name string) (fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[name]
+	return obj, ok
+}
+
+func TestUploadAuditLogs(t *testing.T) {
+	t.Parallel()
+
+	testData := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC))
+
+	t.Run("successfully uploads audit logs", func(t *testing.T) {
+		t.Parallel()
+		fake, server := newFakeGCS(t, "test-bucket")
+
+		uploader, err := gcs.NewUploader(t.Context(), server.Client(), "test-bucket", gcs.UploaderOptions{Endpoint: server.URL})
+		require.NoError(t, err)
+
+		gsURI, err := uploader.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(gsURI, "gs://test-bucket/workspace=workspace-123/year=2024/month=1/day=15/audit-logs-2024-01-15"))
+
+		obj, ok := fake.object(strings.TrimPrefix(gsURI, "gs://test-bucket/"))
+		require.True(t, ok)
+		require.Equal(t, "application/gzip", obj.contentType)
+		require.Empty(t, obj.kmsKeyName)
+
+		gzReader, err := gzip.NewReader(bytes.NewReader(obj.body))
+		require.NoError(t, err)
+		defer gzReader.Close()
+
+		var uploadedData []render.AuditLogEntry
+		require.NoError(t, json.NewDecoder(gzReader).Decode(&uploadedData))
+		require.Equal(t, testData, uploadedData)
+	})
+
+	t.Run("uses customer-managed encryption key", func(t *testing.T) {
+		t.Parallel()
+		fake, server := newFakeGCS(t, "test-bucket")
+
+		const kmsKey = "projects/p/locations/us/keyRings/r/cryptoKeys/k"
+
+		uploader, err := gcs.NewUploader(t.Context(), server.Client(), "test-bucket", gcs.UploaderOptions{
+			Endpoint:   server.URL,
+			KMSKeyName: kmsKey,
+		})
+		require.NoError(t, err)
+
+		gsURI, err := uploader.UploadAuditLogs(t.Context(), auditlogs.OrganizationAuditLog, "org-456", testData)
+		require.NoError(t, err)
+		require.Contains(t, gsURI, "organization=org-456")
+
+		obj, ok := fake.object(strings.TrimPrefix(gsURI, "gs://test-bucket/"))
+		require.True(t, ok)
+		require.Equal(t, kmsKey, obj.kmsKeyName)
+	})
+
+	t.Run("returns error on GCS upload failure", func(t *testing.T) {
+		t.Parallel()
+		fake, server := newFakeGCS(t, "test-bucket")
+		fake.failPuts = true
+
+		uploader, err := gcs.NewUploader(t.Context(), server.Client(), "test-bucket", gcs.UploaderOptions{Endpoint: server.URL})
+		require.NoError(t, err)
+
+		gsURI, err := uploader.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "error uploading to GCS")
+		require.Contains(t, err.Error(), "503")
+		require.Empty(t, gsURI)
+	})
+}
@@ -0,0 +1,84 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+// maxErrorBody is how much of a failed response's body is kept for its error
+const maxErrorBody = 512
+
+// StatusError is returned by Send for a response without a 2xx status
+type StatusError struct {
+	StatusCode int
+	// Body is the start of the response body
+	Body []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, strings.TrimSpace(string(e.Body)))
+}
+
+// WithTimeout returns client, or a new client if it is nil, with its timeout
+// defaulted. A client without a timeout is copied rather than modified, since
+// the caller may share it, e.g. http.DefaultClient.
+func WithTimeout(client *http.Client, timeout time.Duration) *http.Client {
+	if client == nil {
+		return &http.Client{Timeout: timeout}
+	}
+	if client.Timeout > 0 {
+		return client
+	}
+
+	c := *client
+	c.Timeout = timeout
+	return &c
+}
+
+// Gzip compresses a request body sent with Content-Encoding: gzip
+func Gzip(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	if _, err := gzWriter.Write(body); err != nil {
+		return nil, fmt.Errorf("error compressing data: %w", err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		return nil, fmt.Errorf("error closing gzip writer: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Send performs a single request and returns the response body. Transport
+// failures and transient statuses are marked with retry.Retryable, honoring
+// the server's Retry-After, so Send can be called from retry.Do. Any other
+// status is returned as a *StatusError.
+func Send(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, retry.Retryable(fmt.Errorf("error making request: %w", err), 0)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		err := &StatusError{StatusCode: resp.StatusCode, Body: body}
+		if resp.StatusCode == http.StatusRequestTimeout || retry.IsRetryableStatus(resp.StatusCode) {
+			return nil, retry.Retryable(err, retry.RetryAfter(resp.Header))
+		}
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, retry.Retryable(fmt.Errorf("error reading response body: %w", err), 0)
+	}
+
+	return body, nil
+}
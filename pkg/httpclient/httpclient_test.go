@@ -0,0 +1,121 @@
+package httpclient_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/httpclient"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+func TestWithTimeout(t *testing.T) {
+	t.Parallel()
+
+	t.Run("creates a client", func(t *testing.T) {
+		t.Parallel()
+
+		client := httpclient.WithTimeout(nil, time.Minute)
+		require.Equal(t, time.Minute, client.Timeout)
+	})
+
+	t.Run("copies a client without a timeout", func(t *testing.T) {
+		t.Parallel()
+
+		shared := &http.Client{}
+		client := httpclient.WithTimeout(shared, time.Minute)
+
+		require.Equal(t, time.Minute, client.Timeout)
+		require.Zero(t, shared.Timeout)
+	})
+
+	t.Run("keeps a client's timeout", func(t *testing.T) {
+		t.Parallel()
+
+		shared := &http.Client{Timeout: time.Second}
+		require.Same(t, shared, httpclient.WithTimeout(shared, time.Minute))
+	})
+}
+
+func TestGzip(t *testing.T) {
+	compressed, err := httpclient.Gzip([]byte("audit logs"))
+	require.NoError(t, err)
+
+	gzReader, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	body, err := io.ReadAll(gzReader)
+	require.NoError(t, err)
+	require.Equal(t, "audit logs", string(body))
+}
+
+func TestSend(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		status    int
+		retryable bool
+	}{
+		{name: "bad request", status: http.StatusBadRequest},
+		{name: "request timeout", status: http.StatusRequestTimeout, retryable: true},
+		{name: "too many requests", status: http.StatusTooManyRequests, retryable: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, retryable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte("nope\n"))
+			}))
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+			require.NoError(t, err)
+
+			attempts := 0
+			err = retry.Do(t.Context(), retry.Policy{MaxAttempts: 2, InitialBackoff: time.Millisecond}, func() error {
+				attempts++
+				_, err := httpclient.Send(server.Client(), req)
+				return err
+			})
+
+			var statusErr *httpclient.StatusError
+			require.True(t, errors.As(err, &statusErr))
+			require.Equal(t, tt.status, statusErr.StatusCode)
+			require.ErrorContains(t, err, "nope")
+
+			if tt.retryable {
+				require.Equal(t, 2, attempts)
+			} else {
+				require.Equal(t, 1, attempts)
+			}
+		})
+	}
+
+	t.Run("returns the body", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		}))
+		defer server.Close()
+
+		req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+		require.NoError(t, err)
+
+		body, err := httpclient.Send(server.Client(), req)
+		require.NoError(t, err)
+		require.Equal(t, `{"ok":true}`, string(body))
+	})
+}
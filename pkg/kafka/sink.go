@@ -0,0 +1,225 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+const (
+	defaultClientID    = "render-auditlogs"
+	defaultCompression = "snappy"
+)
+
+type SinkOptions struct {
+	ClientID string
+	// Compression is one of none, gzip, snappy, lz4 or zstd
+	Compression string
+	// DisableIdempotence turns off the idempotent producer for clusters that
+	// don't allow it. Only one produce request is kept in flight per broker so
+	// per-tenant order is still preserved across retries.
+	DisableIdempotence bool
+	// SASLMechanism is one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+	// TLS enables TLS to the brokers, it is implied by TLSCAFile
+	TLS bool
+	// TLSCAFile is a PEM file of CAs to trust instead of the system pool
+	TLSCAFile string
+}
+
+// Sink produces one Kafka message per audit log, keyed by the workspace or
+// organization ID so that each tenant's audit logs land on a single partition
+// in order
+type Sink struct {
+	client *kgo.Client
+	topic  string
+}
+
+// message is the value of each produced record
+type message struct {
+	LogType  string          `json:"log_type"`
+	OwnerID  string          `json:"owner_id"`
+	Cursor   string          `json:"cursor"`
+	AuditLog render.AuditLog `json:"auditLog"`
+}
+
+func NewSinkFromConfig(ctx context.Context, cfg *env.Config) (*Sink, error) {
+	if len(cfg.KafkaBrokers) == 0 {
+		return nil, fmt.Errorf("KAFKA_BROKERS is required for the kafka sink")
+	}
+	if cfg.KafkaTopic == "" {
+		return nil, fmt.Errorf("KAFKA_TOPIC is required for the kafka sink")
+	}
+
+	return NewSink(cfg.KafkaBrokers, cfg.KafkaTopic, SinkOptions{
+		ClientID:           cfg.KafkaClientID,
+		Compression:        cfg.KafkaCompression,
+		DisableIdempotence: cfg.KafkaDisableIdempotence,
+		SASLMechanism:      cfg.KafkaSASLMechanism,
+		SASLUsername:       cfg.KafkaSASLUsername,
+		SASLPassword:       cfg.KafkaSASLPassword,
+		TLS:                cfg.KafkaTLS,
+		TLSCAFile:          cfg.KafkaTLSCAFile,
+	})
+}
+
+func NewSink(brokers []string, topic string, opts SinkOptions) (*Sink, error) {
+	if opts.ClientID == "" {
+		opts.ClientID = defaultClientID
+	}
+	if opts.Compression == "" {
+		opts.Compression = defaultCompression
+	}
+
+	codec, err := compressionCodec(opts.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	kopts := []kgo.Opt{
+		kgo.SeedBrokers(brokers...),
+		kgo.ClientID(opts.ClientID),
+		kgo.DefaultProduceTopic(topic),
+		kgo.ProducerBatchCompression(codec),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+	}
+
+	if opts.DisableIdempotence {
+		kopts = append(kopts,
+			kgo.DisableIdempotentWrite(),
+			kgo.MaxProduceRequestsInflightPerBroker(1),
+		)
+	}
+
+	if opts.SASLMechanism != "" {
+		mechanism, err := saslMechanism(opts.SASLMechanism, opts.SASLUsername, opts.SASLPassword)
+		if err != nil {
+			return nil, err
+		}
+		kopts = append(kopts, kgo.SASL(mechanism))
+	}
+
+	if opts.TLS || opts.TLSCAFile != "" {
+		tlsConfig, err := newTLSConfig(opts.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		kopts = append(kopts, kgo.DialTLSConfig(tlsConfig))
+	}
+
+	client, err := kgo.NewClient(kopts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Kafka client: %w", err)
+	}
+
+	return &Sink{
+		client: client,
+		topic:  topic,
+	}, nil
+}
+
+// UploadAuditLogs produces a message per audit log and only returns once every
+// message has been acknowledged by the brokers, so the checkpoint is never
+// advanced past an audit log that may have been lost
+func (s *Sink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	records := make([]*kgo.Record, 0, len(data))
+	for _, entry := range data {
+		value, err := json.Marshal(message{
+			LogType:  string(auditLogType),
+			OwnerID:  id,
+			Cursor:   entry.Cursor,
+			AuditLog: entry.AuditLog,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error marshaling message: %w", err)
+		}
+
+		records = append(records, &kgo.Record{
+			Key:       []byte(id),
+			Value:     value,
+			Timestamp: entry.AuditLog.Timestamp,
+			Headers: []kgo.RecordHeader{
+				{Key: "log_type", Value: []byte(auditLogType)},
+				{Key: "audit_log_id", Value: []byte(entry.AuditLog.ID)},
+			},
+		})
+	}
+
+	if err := s.client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		return "", fmt.Errorf("error producing audit logs to %s: %w", s.topic, err)
+	}
+
+	return "kafka://" + s.topic, nil
+}
+
+// Close flushes any buffered messages and closes the connections to the
+// brokers
+func (s *Sink) Close() error {
+	s.client.Close()
+	return nil
+}
+
+func compressionCodec(name string) (kgo.CompressionCodec, error) {
+	switch strings.ToLower(name) {
+	case "none":
+		return kgo.NoCompression(), nil
+	case "gzip":
+		return kgo.GzipCompression(), nil
+	case "snappy":
+		return kgo.SnappyCompression(), nil
+	case "lz4":
+		return kgo.Lz4Compression(), nil
+	case "zstd":
+		return kgo.ZstdCompression(), nil
+	default:
+		return kgo.CompressionCodec{}, fmt.Errorf("unknown Kafka compression %q, must be one of: none, gzip, snappy, lz4, zstd", name)
+	}
+}
+
+func saslMechanism(name, username, password string) (sasl.Mechanism, error) {
+	switch strings.ToUpper(name) {
+	case "PLAIN":
+		return plain.Auth{User: username, Pass: password}.AsMechanism(), nil
+	case "SCRAM-SHA-256":
+		return scram.Auth{User: username, Pass: password}.AsSha256Mechanism(), nil
+	case "SCRAM-SHA-512":
+		return scram.Auth{User: username, Pass: password}.AsSha512Mechanism(), nil
+	default:
+		return nil, fmt.Errorf("unknown SASL mechanism %q, must be one of: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512", name)
+	}
+}
+
+func newTLSConfig(caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Kafka CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in Kafka CA file %s", caFile)
+	}
+	tlsConfig.RootCAs = pool
+
+	return tlsConfig, nil
+}
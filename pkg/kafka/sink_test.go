@@ -0,0 +1,145 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/kafka"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+const topic = "render-audit-logs"
+
+type producedMessage struct {
+	LogType  string `json:"log_type"`
+	OwnerID  string `json:"owner_id"`
+	Cursor   string `json:"cursor"`
+	AuditLog struct {
+		ID string `json:"id"`
+	} `json:"auditLog"`
+}
+
+func newCluster(t *testing.T) *kfake.Cluster {
+	t.Helper()
+
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, topic))
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+
+	return cluster
+}
+
+func consumeAll(t *testing.T, brokers []string, n int) []*kgo.Record {
+	t.Helper()
+
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var records []*kgo.Record
+	for len(records) < n {
+		fetches := client.PollFetches(ctx)
+		require.NoError(t, ctx.Err())
+		fetches.EachRecord(func(r *kgo.Record) {
+			records = append(records, r)
+		})
+	}
+
+	return records
+}
+
+func TestUploadAuditLogs(t *testing.T) {
+	ctx := context.Background()
+	cluster := newCluster(t)
+
+	s, err := kafka.NewSink(cluster.ListenAddrs(), topic, kafka.SinkOptions{Compression: "zstd"})
+	require.NoError(t, err)
+	defer s.Close()
+
+	date := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	workspaceLogs := testhelpers.CreateTestAuditLogs(20, date)
+	organizationLogs := testhelpers.CreateTestAuditLogs(5, date)
+
+	location, err := s.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", workspaceLogs)
+	require.NoError(t, err)
+	require.Equal(t, "kafka://"+topic, location)
+
+	_, err = s.UploadAuditLogs(ctx, auditlogs.OrganizationAuditLog, "org-456", organizationLogs)
+	require.NoError(t, err)
+
+	records := consumeAll(t, cluster.ListenAddrs(), 25)
+
+	byOwner := map[string][]producedMessage{}
+	partitions := map[string]int32{}
+	for _, r := range records {
+		var msg producedMessage
+		require.NoError(t, json.Unmarshal(r.Value, &msg))
+		require.Equal(t, string(r.Key), msg.OwnerID)
+
+		if p, ok := partitions[msg.OwnerID]; ok {
+			require.Equal(t, p, r.Partition, "all messages for an owner should be on one partition")
+		}
+		partitions[msg.OwnerID] = r.Partition
+
+		byOwner[msg.OwnerID] = append(byOwner[msg.OwnerID], msg)
+	}
+
+	require.Len(t, byOwner["tea-123"], 20)
+	require.Len(t, byOwner["org-456"], 5)
+
+	for i, msg := range byOwner["tea-123"] {
+		require.Equal(t, string(auditlogs.WorkspaceAuditLog), msg.LogType)
+		require.Equal(t, workspaceLogs[i].AuditLog.ID, msg.AuditLog.ID, "messages should be in order")
+		require.Equal(t, workspaceLogs[i].Cursor, msg.Cursor)
+	}
+	for i, msg := range byOwner["org-456"] {
+		require.Equal(t, string(auditlogs.OrganizationAuditLog), msg.LogType)
+		require.Equal(t, organizationLogs[i].AuditLog.ID, msg.AuditLog.ID)
+	}
+
+	timestamps := map[string]time.Time{}
+	for _, entry := range append(workspaceLogs, organizationLogs...) {
+		timestamps[entry.AuditLog.ID] = entry.AuditLog.Timestamp
+	}
+	for _, r := range records {
+		var msg producedMessage
+		require.NoError(t, json.Unmarshal(r.Value, &msg))
+		require.True(t, timestamps[msg.AuditLog.ID].Equal(r.Timestamp), "record timestamp should be the audit log's")
+	}
+}
+
+func TestUploadAuditLogsFailsWhenTopicMissing(t *testing.T) {
+	cluster := newCluster(t)
+
+	s, err := kafka.NewSink(cluster.ListenAddrs(), "missing-topic", kafka.SinkOptions{})
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err = s.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(1, time.Now()))
+	require.Error(t, err)
+}
+
+func TestNewSinkRejectsUnknownOptions(t *testing.T) {
+	_, err := kafka.NewSink([]string{"localhost:9092"}, topic, kafka.SinkOptions{Compression: "brotli"})
+	require.ErrorContains(t, err, "unknown Kafka compression")
+
+	_, err = kafka.NewSink([]string{"localhost:9092"}, topic, kafka.SinkOptions{SASLMechanism: "GSSAPI"})
+	require.ErrorContains(t, err, "unknown SASL mechanism")
+}
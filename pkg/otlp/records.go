@@ -0,0 +1,103 @@
+package otlp
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+const (
+	scopeName = "github.com/renderinc/render-auditlogs"
+
+	// MetadataAttributePrefix is prepended to each metadata key to form its
+	// log record attribute
+	MetadataAttributePrefix = "render.metadata."
+
+	successStatus = "success"
+)
+
+// newExportRequest builds a request with a single resource for the workspace
+// or organization the audit logs belong to
+func newExportRequest(serviceName string, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry, observed time.Time) *collogspb.ExportLogsServiceRequest {
+	records := make([]*logspb.LogRecord, 0, len(data))
+	for _, entry := range data {
+		records = append(records, newLogRecord(entry, observed))
+	}
+
+	return &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: &resourcepb.Resource{
+				Attributes: []*commonpb.KeyValue{
+					stringAttribute("service.name", serviceName),
+					stringAttribute("render.log_type", string(auditLogType)),
+					stringAttribute(ownerAttribute(auditLogType), id),
+				},
+			},
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: scopeName},
+				LogRecords: records,
+			}},
+		}},
+	}
+}
+
+// newLogRecord converts an audit log into a log record. The body is the audit
+// log as JSON, and its fields are also attributes so they can be filtered on
+// without parsing the body.
+func newLogRecord(entry render.AuditLogEntry, observed time.Time) *logspb.LogRecord {
+	auditLog := entry.AuditLog
+
+	severity := logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	if auditLog.Status != successStatus {
+		severity = logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	}
+
+	attributes := []*commonpb.KeyValue{
+		stringAttribute("event.name", auditLog.Event),
+		stringAttribute("render.audit_log.id", auditLog.ID),
+		stringAttribute("render.audit_log.cursor", entry.Cursor),
+		stringAttribute("render.audit_log.status", auditLog.Status),
+		stringAttribute("render.actor.type", auditLog.Actor.Type),
+		stringAttribute("render.actor.id", auditLog.Actor.ID),
+		stringAttribute("render.actor.email", auditLog.Actor.Email),
+	}
+	for _, k := range slices.Sorted(maps.Keys(auditLog.Metadata)) {
+		attributes = append(attributes, stringAttribute(MetadataAttributePrefix+k, auditLog.Metadata[k]))
+	}
+
+	// Marshaling a struct of strings and a string map can't fail
+	body, _ := json.Marshal(auditLog)
+
+	return &logspb.LogRecord{
+		TimeUnixNano:         uint64(auditLog.Timestamp.UnixNano()),
+		ObservedTimeUnixNano: uint64(observed.UnixNano()),
+		SeverityNumber:       severity,
+		SeverityText:         auditLog.Status,
+		EventName:            auditLog.Event,
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: string(body)}},
+		Attributes:           attributes,
+	}
+}
+
+func ownerAttribute(auditLogType auditlogs.LogType) string {
+	if auditLogType == auditlogs.OrganizationAuditLog {
+		return "render.organization.id"
+	}
+	return "render.workspace.id"
+}
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
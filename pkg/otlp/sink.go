@@ -0,0 +1,278 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/logger"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+const (
+	ProtocolGRPC         = "grpc"
+	ProtocolHTTPProtobuf = "http/protobuf"
+
+	defaultServiceName = "render-auditlogs"
+	defaultBatchSize   = 512
+	defaultTimeout     = 30 * time.Second
+
+	logsPath = "/v1/logs"
+)
+
+type SinkOptions struct {
+	// Protocol is grpc (the default) or http/protobuf
+	Protocol string
+	// Headers are sent with every export, as gRPC metadata or HTTP headers
+	Headers map[string]string
+	// Insecure disables TLS for gRPC. It can't be set for HTTP, where the
+	// endpoint's scheme decides.
+	Insecure bool
+	// ServiceName is the service.name resource attribute
+	ServiceName string
+	// BatchSize is the maximum number of log records per export
+	BatchSize int
+	// Timeout bounds each export attempt
+	Timeout time.Duration
+	Retry   retry.Policy
+}
+
+// Sink exports audit logs as OTLP log records to an OpenTelemetry collector
+type Sink struct {
+	endpoint string
+	opts     SinkOptions
+	export   func(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error)
+	close    func() error
+}
+
+func NewSinkFromConfig(ctx context.Context, cfg *env.Config) (*Sink, error) {
+	if cfg.OTLPEndpoint == "" {
+		return nil, fmt.Errorf("OTLP_ENDPOINT is required for the otlp sink")
+	}
+
+	return NewSink(cfg.OTLPEndpoint, SinkOptions{
+		Protocol:    cfg.OTLPProtocol,
+		Headers:     cfg.OTLPHeaders,
+		Insecure:    cfg.OTLPInsecure,
+		ServiceName: cfg.OTLPServiceName,
+		BatchSize:   cfg.OTLPBatchSize,
+		Timeout:     cfg.SinkRequestTimeout,
+		Retry: retry.Policy{
+			MaxAttempts:    cfg.SinkRetryMaxAttempts,
+			InitialBackoff: cfg.SinkRetryInitialBackoff,
+			MaxBackoff:     cfg.SinkRetryMaxBackoff,
+		},
+	})
+}
+
+// NewSink connects to the collector at endpoint, which is host:port for gRPC
+// and a URL for HTTP. An HTTP URL without a path is sent to /v1/logs.
+func NewSink(endpoint string, opts SinkOptions) (*Sink, error) {
+	if opts.Protocol == "" {
+		opts.Protocol = ProtocolGRPC
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = defaultServiceName
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	s := &Sink{endpoint: endpoint, opts: opts}
+
+	switch opts.Protocol {
+	case ProtocolGRPC:
+		creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		if opts.Insecure {
+			creds = insecure.NewCredentials()
+		}
+
+		conn, err := grpc.NewClient(endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("error creating OTLP gRPC client: %w", err)
+		}
+
+		client := collogspb.NewLogsServiceClient(conn)
+		s.export = func(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+			return s.exportGRPC(ctx, client, req)
+		}
+		s.close = conn.Close
+	case ProtocolHTTPProtobuf:
+		if opts.Insecure {
+			return nil, fmt.Errorf("OTLP insecure only applies to %s, use an http:// endpoint to disable TLS for %s", ProtocolGRPC, ProtocolHTTPProtobuf)
+		}
+
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid OTLP HTTP endpoint %q", endpoint)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = logsPath
+		}
+		s.endpoint = u.String()
+
+		httpClient := &http.Client{Timeout: opts.Timeout}
+		s.export = func(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+			return s.exportHTTP(ctx, httpClient, req)
+		}
+		s.close = func() error {
+			httpClient.CloseIdleConnections()
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q, must be %s or %s", opts.Protocol, ProtocolGRPC, ProtocolHTTPProtobuf)
+	}
+
+	return s, nil
+}
+
+// UploadAuditLogs exports audit logs in batches of at most BatchSize, in
+// order. Records the collector rejects as partial success are logged rather
+// than retried, since resending them would be rejected again.
+func (s *Sink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	for start := 0; start < len(data); start += s.opts.BatchSize {
+		end := min(start+s.opts.BatchSize, len(data))
+		req := newExportRequest(s.opts.ServiceName, auditLogType, id, data[start:end], time.Now())
+
+		var resp *collogspb.ExportLogsServiceResponse
+		if err := retry.Do(ctx, s.opts.Retry, func() error {
+			var err error
+			resp, err = s.export(ctx, req)
+			return err
+		}); err != nil {
+			return "", fmt.Errorf("error exporting audit logs over OTLP: %w", err)
+		}
+
+		if partial := resp.GetPartialSuccess(); partial.GetRejectedLogRecords() > 0 || partial.GetErrorMessage() != "" {
+			logger.FromContext(ctx).Warn("collector rejected some log records",
+				"rejected", partial.GetRejectedLogRecords(),
+				"total", end-start,
+				"message", partial.GetErrorMessage(),
+			)
+		}
+	}
+
+	return s.endpoint, nil
+}
+
+// Close closes the connection to the collector
+func (s *Sink) Close() error {
+	return s.close()
+}
+
+func (s *Sink) exportGRPC(ctx context.Context, client collogspb.LogsServiceClient, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+
+	for k, v := range s.opts.Headers {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(k), v)
+	}
+
+	resp, err := client.Export(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+
+	st := status.Convert(err)
+	err = fmt.Errorf("OTLP export failed with code %s: %s", st.Code(), st.Message())
+
+	return nil, retryableStatus(err, st.Code(), st.Details())
+}
+
+func (s *Sink) exportHTTP(ctx context.Context, httpClient *http.Client, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling export request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	for k, v := range s.opts.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, retry.Retryable(fmt.Errorf("error making request: %w", err), 0)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, retry.Retryable(fmt.Errorf("error reading response: %w", err), 0)
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		var out collogspb.ExportLogsServiceResponse
+		if err := proto.Unmarshal(respBody, &out); err != nil {
+			return nil, fmt.Errorf("error unmarshaling export response: %w", err)
+		}
+		return &out, nil
+	}
+
+	// Collectors describe failures with a protobuf google.rpc.Status
+	message := strings.TrimSpace(string(respBody[:min(len(respBody), 512)]))
+	var st statuspb.Status
+	if proto.Unmarshal(respBody, &st) == nil && st.GetMessage() != "" {
+		message = st.GetMessage()
+	}
+
+	err = fmt.Errorf("OTLP export failed with status %d: %s", resp.StatusCode, message)
+	if retry.IsRetryableStatus(resp.StatusCode) {
+		return nil, retry.Retryable(err, retry.RetryAfter(resp.Header))
+	}
+
+	return nil, err
+}
+
+// retryableStatus marks err as retryable for the gRPC codes the OTLP
+// specification considers transient. RESOURCE_EXHAUSTED is only retried when
+// the server says when to retry.
+func retryableStatus(err error, code codes.Code, details []any) error {
+	var after time.Duration
+	hasRetryInfo := false
+	for _, d := range details {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			hasRetryInfo = true
+			after = info.GetRetryDelay().AsDuration()
+		}
+	}
+
+	switch code {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		return retry.Retryable(err, after)
+	case codes.ResourceExhausted:
+		if hasRetryInfo {
+			return retry.Retryable(err, after)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,330 @@
+package otlp_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/otlp"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+var fastRetry = retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+// fakeCollector records the export requests it receives over gRPC, failing
+// the first failFirst of them
+type fakeCollector struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	mu        sync.Mutex
+	requests  []*collogspb.ExportLogsServiceRequest
+	metadata  []metadata.MD
+	calls     int
+	failFirst int
+	failCode  codes.Code
+	rejected  int64
+}
+
+func (f *fakeCollector) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.calls <= f.failFirst {
+		return nil, status.Error(f.failCode, "collector unavailable")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	f.metadata = append(f.metadata, md)
+	f.requests = append(f.requests, req)
+
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if f.rejected > 0 {
+		resp.PartialSuccess = &collogspb.ExportLogsPartialSuccess{RejectedLogRecords: f.rejected, ErrorMessage: "too old"}
+	}
+	return resp, nil
+}
+
+func startGRPCCollector(t *testing.T, collector *fakeCollector) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(server, collector)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	return lis.Addr().String()
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	m := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		m[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	return m
+}
+
+func logRecords(reqs []*collogspb.ExportLogsServiceRequest) []*logspb.LogRecord {
+	var records []*logspb.LogRecord
+	for _, req := range reqs {
+		for _, rl := range req.GetResourceLogs() {
+			for _, sl := range rl.GetScopeLogs() {
+				records = append(records, sl.GetLogRecords()...)
+			}
+		}
+	}
+	return records
+}
+
+func TestUploadAuditLogsGRPC(t *testing.T) {
+	t.Parallel()
+
+	testDate := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	t.Run("exports audit logs as log records in batches", func(t *testing.T) {
+		t.Parallel()
+		collector := &fakeCollector{}
+		endpoint := startGRPCCollector(t, collector)
+
+		testData := testhelpers.CreateTestAuditLogs(5, testDate)
+		testData[1].AuditLog.Status = "failure"
+		testData[2].AuditLog.Metadata = map[string]string{"serviceId": "srv-123"}
+
+		sink, err := otlp.NewSink(endpoint, otlp.SinkOptions{
+			Insecure:  true,
+			Headers:   map[string]string{"Authorization": "Bearer abc123"},
+			BatchSize: 2,
+			Retry:     fastRetry,
+		})
+		require.NoError(t, err)
+		defer sink.Close()
+
+		location, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+		require.Equal(t, endpoint, location)
+
+		require.Len(t, collector.requests, 3)
+		for i, req := range collector.requests {
+			require.Len(t, req.GetResourceLogs(), 1)
+			require.Equal(t, map[string]string{
+				"service.name":        "render-auditlogs",
+				"render.log_type":     "workspace",
+				"render.workspace.id": "tea-123",
+			}, attributes(req.GetResourceLogs()[0].GetResource().GetAttributes()))
+			require.Equal(t, []string{"Bearer abc123"}, collector.metadata[i].Get("authorization"))
+		}
+
+		records := logRecords(collector.requests)
+		require.Len(t, records, 5)
+		for i, record := range records {
+			auditLog := testData[i].AuditLog
+			require.Equal(t, uint64(auditLog.Timestamp.UnixNano()), record.GetTimeUnixNano())
+			require.NotZero(t, record.GetObservedTimeUnixNano())
+			require.Equal(t, auditLog.Status, record.GetSeverityText())
+			require.Equal(t, "LoginEvent", record.GetEventName())
+			require.Contains(t, record.GetBody().GetStringValue(), auditLog.ID)
+
+			attrs := attributes(record.GetAttributes())
+			require.Equal(t, auditLog.ID, attrs["render.audit_log.id"])
+			require.Equal(t, testData[i].Cursor, attrs["render.audit_log.cursor"])
+			require.Equal(t, "LoginEvent", attrs["event.name"])
+			require.Equal(t, "test@example.com", attrs["render.actor.email"])
+		}
+
+		require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_INFO, records[0].GetSeverityNumber())
+		require.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, records[1].GetSeverityNumber())
+		require.Equal(t, "srv-123", attributes(records[2].GetAttributes())["render.metadata.serviceId"])
+	})
+
+	t.Run("uses the organization ID resource attribute", func(t *testing.T) {
+		t.Parallel()
+		collector := &fakeCollector{}
+		endpoint := startGRPCCollector(t, collector)
+
+		sink, err := otlp.NewSink(endpoint, otlp.SinkOptions{Insecure: true, ServiceName: "audit", Retry: fastRetry})
+		require.NoError(t, err)
+		defer sink.Close()
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.OrganizationAuditLog, "org-456", testhelpers.CreateTestAuditLogs(1, testDate))
+		require.NoError(t, err)
+
+		require.Len(t, collector.requests, 1)
+		require.Equal(t, map[string]string{
+			"service.name":           "audit",
+			"render.log_type":        "organization",
+			"render.organization.id": "org-456",
+		}, attributes(collector.requests[0].GetResourceLogs()[0].GetResource().GetAttributes()))
+	})
+
+	t.Run("retries unavailable collectors", func(t *testing.T) {
+		t.Parallel()
+		collector := &fakeCollector{failFirst: 2, failCode: codes.Unavailable}
+		endpoint := startGRPCCollector(t, collector)
+
+		sink, err := otlp.NewSink(endpoint, otlp.SinkOptions{Insecure: true, Retry: fastRetry})
+		require.NoError(t, err)
+		defer sink.Close()
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(3, testDate))
+		require.NoError(t, err)
+		require.Equal(t, 3, collector.calls)
+		require.Len(t, logRecords(collector.requests), 3)
+	})
+
+	t.Run("returns error when logs are rejected", func(t *testing.T) {
+		t.Parallel()
+		collector := &fakeCollector{failFirst: 1, failCode: codes.InvalidArgument}
+		endpoint := startGRPCCollector(t, collector)
+
+		sink, err := otlp.NewSink(endpoint, otlp.SinkOptions{Insecure: true, Retry: fastRetry})
+		require.NoError(t, err)
+		defer sink.Close()
+
+		location, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(1, testDate))
+		require.ErrorContains(t, err, "InvalidArgument")
+		require.Empty(t, location)
+		require.Equal(t, 1, collector.calls)
+	})
+
+	t.Run("accepts partial success", func(t *testing.T) {
+		t.Parallel()
+		collector := &fakeCollector{rejected: 1}
+		endpoint := startGRPCCollector(t, collector)
+
+		sink, err := otlp.NewSink(endpoint, otlp.SinkOptions{Insecure: true, Retry: fastRetry})
+		require.NoError(t, err)
+		defer sink.Close()
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(2, testDate))
+		require.NoError(t, err)
+		require.Equal(t, 1, collector.calls)
+	})
+}
+
+func TestUploadAuditLogsHTTP(t *testing.T) {
+	t.Parallel()
+
+	testDate := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	newServer := func(t *testing.T, failFirst int, reqs *[]*collogspb.ExportLogsServiceRequest, headers *[]http.Header) *httptest.Server {
+		var mu sync.Mutex
+		calls := 0
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			calls++
+			*headers = append(*headers, r.Header.Clone())
+			if r.URL.Path != "/v1/logs" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if calls <= failFirst {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+
+			var req collogspb.ExportLogsServiceRequest
+			if err := proto.Unmarshal(body, &req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			*reqs = append(*reqs, &req)
+
+			resp, _ := proto.Marshal(&collogspb.ExportLogsServiceResponse{})
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			_, _ = w.Write(resp)
+		}))
+		t.Cleanup(server.Close)
+
+		return server
+	}
+
+	t.Run("posts protobuf to /v1/logs", func(t *testing.T) {
+		t.Parallel()
+		var reqs []*collogspb.ExportLogsServiceRequest
+		var headers []http.Header
+		server := newServer(t, 0, &reqs, &headers)
+
+		sink, err := otlp.NewSink(server.URL, otlp.SinkOptions{
+			Protocol: otlp.ProtocolHTTPProtobuf,
+			Headers:  map[string]string{"Authorization": "Bearer abc123"},
+			Retry:    fastRetry,
+		})
+		require.NoError(t, err)
+		defer sink.Close()
+
+		location, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(3, testDate))
+		require.NoError(t, err)
+		require.Equal(t, server.URL+"/v1/logs", location)
+
+		require.Len(t, reqs, 1)
+		require.Len(t, logRecords(reqs), 3)
+		require.Equal(t, "Bearer abc123", headers[0].Get("Authorization"))
+		require.Equal(t, "application/x-protobuf", headers[0].Get("Content-Type"))
+	})
+
+	t.Run("retries server errors", func(t *testing.T) {
+		t.Parallel()
+		var reqs []*collogspb.ExportLogsServiceRequest
+		var headers []http.Header
+		server := newServer(t, 2, &reqs, &headers)
+
+		sink, err := otlp.NewSink(server.URL, otlp.SinkOptions{Protocol: otlp.ProtocolHTTPProtobuf, Retry: fastRetry})
+		require.NoError(t, err)
+		defer sink.Close()
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(3, testDate))
+		require.NoError(t, err)
+		require.Len(t, headers, 3)
+		require.Len(t, reqs, 1)
+	})
+
+	t.Run("returns error when logs are rejected", func(t *testing.T) {
+		t.Parallel()
+		var reqs []*collogspb.ExportLogsServiceRequest
+		var headers []http.Header
+		server := newServer(t, 0, &reqs, &headers)
+
+		// A custom path is used as is, and isn't found here
+		sink, err := otlp.NewSink(server.URL+"/custom", otlp.SinkOptions{Protocol: otlp.ProtocolHTTPProtobuf, Retry: fastRetry})
+		require.NoError(t, err)
+		defer sink.Close()
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(1, testDate))
+		require.ErrorContains(t, err, "status 404")
+		require.Len(t, headers, 1)
+	})
+}
+
+func TestNewSinkRejectsInvalidOptions(t *testing.T) {
+	_, err := otlp.NewSink("collector:4317", otlp.SinkOptions{Protocol: "http/json"})
+	require.ErrorContains(t, err, "unknown OTLP protocol")
+
+	_, err = otlp.NewSink("https://collector:4318", otlp.SinkOptions{Protocol: otlp.ProtocolHTTPProtobuf, Insecure: true})
+	require.ErrorContains(t, err, "insecure only applies to grpc")
+}
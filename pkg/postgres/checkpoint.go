@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+)
+
+// LoadCheckpoint reads the checkpoint row. Returns nil if it doesn't exist.
+func (s *Sink) LoadCheckpoint(ctx context.Context, logType auditlogs.LogType, id string) (*checkpoint.Checkpoint, error) {
+	var cp checkpoint.Checkpoint
+
+	err := s.pool.QueryRow(ctx,
+		`SELECT last_cursor, last_timestamp FROM `+checkpointsTable+` WHERE log_type = $1 AND owner_id = $2`,
+		string(logType), id,
+	).Scan(&cp.LastCursor, &cp.LastTimestamp)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// No checkpoint has been saved yet, return nil
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading checkpoint from Postgres: %w", err)
+	}
+
+	cp.LastTimestamp = cp.LastTimestamp.UTC()
+
+	return &cp, nil
+}
+
+// SaveCheckpoint upserts the checkpoint row. When Postgres is also the sink the
+// checkpoint has already been saved with the audit logs, and this is a no-op
+// write of the same values.
+func (s *Sink) SaveCheckpoint(ctx context.Context, cp *checkpoint.Checkpoint, logType auditlogs.LogType, id string) error {
+	return saveCheckpoint(ctx, s.pool, logType, id, cp.LastCursor, cp.LastTimestamp)
+}
+
+// execer is satisfied by both the pool and a transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func saveCheckpoint(ctx context.Context, db execer, logType auditlogs.LogType, id, cursor string, timestamp time.Time) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO `+checkpointsTable+` (log_type, owner_id, last_cursor, last_timestamp)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (log_type, owner_id) DO UPDATE SET
+			last_cursor = excluded.last_cursor,
+			last_timestamp = excluded.last_timestamp,
+			updated_at = now()`,
+		string(logType), id, cursor, timestamp,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving checkpoint to Postgres: %w", err)
+	}
+
+	return nil
+}
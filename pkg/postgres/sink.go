@@ -0,0 +1,206 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+const (
+	auditLogsTable   = "render_audit_logs"
+	checkpointsTable = "render_audit_log_checkpoints"
+	migrationsTable  = "render_audit_logs_schema_migrations"
+
+	// migrationLockID serializes migrations between concurrent processes
+	migrationLockID = 7215508441
+)
+
+// migrations are applied in order, each exactly once. Append new migrations,
+// never edit applied ones.
+var migrations = []string{
+	`CREATE TABLE ` + auditLogsTable + ` (
+		id          text PRIMARY KEY,
+		log_type    text NOT NULL,
+		owner_id    text NOT NULL,
+		cursor      text NOT NULL,
+		"timestamp" timestamptz NOT NULL,
+		event       text NOT NULL,
+		status      text NOT NULL,
+		actor_type  text NOT NULL,
+		actor_id    text NOT NULL,
+		actor_email text NOT NULL,
+		metadata    jsonb NOT NULL DEFAULT '{}',
+		inserted_at timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX ` + auditLogsTable + `_owner_timestamp_idx ON ` + auditLogsTable + ` (log_type, owner_id, "timestamp")`,
+	`CREATE TABLE ` + checkpointsTable + ` (
+		log_type       text NOT NULL,
+		owner_id       text NOT NULL,
+		last_cursor    text NOT NULL,
+		last_timestamp timestamptz NOT NULL,
+		updated_at     timestamptz NOT NULL DEFAULT now(),
+		PRIMARY KEY (log_type, owner_id)
+	)`,
+}
+
+var stagingColumns = []string{
+	"id", "log_type", "owner_id", "cursor", "timestamp", "event", "status",
+	"actor_type", "actor_id", "actor_email", "metadata",
+}
+
+// Sink loads audit logs into a PostgreSQL table, one row per audit log keyed
+// on its ID. The checkpoint is written in the same transaction as the rows, so
+// when Postgres is also the checkpoint store every audit log is stored exactly
+// once.
+type Sink struct {
+	pool *pgxpool.Pool
+}
+
+func NewSinkFromConfig(ctx context.Context, cfg *env.Config) (*Sink, error) {
+	if cfg.PostgresURL == "" {
+		return nil, fmt.Errorf("POSTGRES_URL is required for the postgres sink")
+	}
+
+	pool, err := pgxpool.New(ctx, cfg.PostgresURL)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to Postgres: %w", err)
+	}
+
+	s, err := NewSink(ctx, pool)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewSink migrates the schema to the latest version
+func NewSink(ctx context.Context, pool *pgxpool.Pool) (*Sink, error) {
+	if err := migrate(ctx, pool); err != nil {
+		return nil, fmt.Errorf("error migrating Postgres schema: %w", err)
+	}
+
+	return &Sink{pool: pool}, nil
+}
+
+// UploadAuditLogs copies audit logs into a staging table and upserts them, so
+// re-uploading a page updates the existing rows instead of duplicating them.
+// The checkpoint is advanced to the last audit log in the same transaction.
+func (s *Sink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	if len(data) == 0 {
+		return auditLogsTable, nil
+	}
+
+	rows := make([][]any, 0, len(data))
+	for _, entry := range data {
+		metadata := []byte("{}")
+		if len(entry.AuditLog.Metadata) > 0 {
+			var err error
+			metadata, err = json.Marshal(entry.AuditLog.Metadata)
+			if err != nil {
+				return "", fmt.Errorf("error marshaling metadata: %w", err)
+			}
+		}
+
+		rows = append(rows, []any{
+			entry.AuditLog.ID,
+			string(auditLogType),
+			id,
+			entry.Cursor,
+			entry.AuditLog.Timestamp,
+			entry.AuditLog.Event,
+			entry.AuditLog.Status,
+			entry.AuditLog.Actor.Type,
+			entry.AuditLog.Actor.ID,
+			entry.AuditLog.Actor.Email,
+			metadata,
+		})
+	}
+
+	last := data[len(data)-1]
+
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `CREATE TEMP TABLE staging (LIKE `+auditLogsTable+` INCLUDING DEFAULTS) ON COMMIT DROP`); err != nil {
+			return fmt.Errorf("error creating staging table: %w", err)
+		}
+
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"staging"}, stagingColumns, pgx.CopyFromRows(rows)); err != nil {
+			return fmt.Errorf("error copying audit logs: %w", err)
+		}
+
+		// DISTINCT ON guards against a page containing the same audit log twice,
+		// which ON CONFLICT can't update twice in one statement
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO `+auditLogsTable+` (id, log_type, owner_id, cursor, "timestamp", event, status, actor_type, actor_id, actor_email, metadata)
+			SELECT DISTINCT ON (id) id, log_type, owner_id, cursor, "timestamp", event, status, actor_type, actor_id, actor_email, metadata
+			FROM staging
+			ON CONFLICT (id) DO UPDATE SET
+				log_type = excluded.log_type,
+				owner_id = excluded.owner_id,
+				cursor = excluded.cursor,
+				"timestamp" = excluded."timestamp",
+				event = excluded.event,
+				status = excluded.status,
+				actor_type = excluded.actor_type,
+				actor_id = excluded.actor_id,
+				actor_email = excluded.actor_email,
+				metadata = excluded.metadata`,
+		); err != nil {
+			return fmt.Errorf("error upserting audit logs: %w", err)
+		}
+
+		return saveCheckpoint(ctx, tx, auditLogType, id, last.Cursor, last.AuditLog.Timestamp)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return auditLogsTable, nil
+}
+
+// Close closes the connection pool
+func (s *Sink) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+// migrate applies the migrations that haven't been applied yet in a single
+// transaction, holding an advisory lock so concurrent runs don't race
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+			return fmt.Errorf("error acquiring migration lock: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+migrationsTable+` (
+			version    integer PRIMARY KEY,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`); err != nil {
+			return fmt.Errorf("error creating migrations table: %w", err)
+		}
+
+		var version int
+		if err := tx.QueryRow(ctx, `SELECT COALESCE(max(version), 0) FROM `+migrationsTable).Scan(&version); err != nil {
+			return fmt.Errorf("error reading schema version: %w", err)
+		}
+
+		for i := version; i < len(migrations); i++ {
+			if _, err := tx.Exec(ctx, migrations[i]); err != nil {
+				return fmt.Errorf("error applying migration %d: %w", i+1, err)
+			}
+			if _, err := tx.Exec(ctx, `INSERT INTO `+migrationsTable+` (version) VALUES ($1)`, i+1); err != nil {
+				return fmt.Errorf("error recording migration %d: %w", i+1, err)
+			}
+		}
+
+		return nil
+	})
+}
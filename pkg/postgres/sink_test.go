@@ -0,0 +1,172 @@
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+	"github.com/renderinc/render-auditlogs/pkg/postgres"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+// newPool connects to the database in POSTGRES_TEST_URL with a fresh schema
+// first in the search path, so every test starts from an empty database
+func newPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL is not set")
+	}
+
+	ctx := context.Background()
+	schema := "test_" + uuid.NewString()[:8]
+
+	admin, err := pgxpool.New(ctx, url)
+	require.NoError(t, err)
+	t.Cleanup(admin.Close)
+
+	_, err = admin.Exec(ctx, fmt.Sprintf("CREATE SCHEMA %q", schema))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = admin.Exec(context.Background(), fmt.Sprintf("DROP SCHEMA %q CASCADE", schema))
+	})
+
+	cfg, err := pgxpool.ParseConfig(url)
+	require.NoError(t, err)
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+func TestUploadAuditLogs(t *testing.T) {
+	ctx := context.Background()
+	pool := newPool(t)
+
+	s, err := postgres.NewSink(ctx, pool)
+	require.NoError(t, err)
+
+	testData := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC))
+	testData[1].AuditLog.Metadata = map[string]string{"serviceId": "srv-123"}
+
+	location, err := s.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+	require.NoError(t, err)
+	require.Equal(t, "render_audit_logs", location)
+
+	rows, err := pool.Query(ctx, `SELECT id, log_type, owner_id, cursor, "timestamp", event, status, actor_email, metadata->>'serviceId' FROM render_audit_logs ORDER BY "timestamp"`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	i := 0
+	for rows.Next() {
+		var id, logType, ownerID, cursor, event, status, email string
+		var serviceID *string
+		var timestamp time.Time
+		require.NoError(t, rows.Scan(&id, &logType, &ownerID, &cursor, &timestamp, &event, &status, &email, &serviceID))
+
+		entry := testData[i]
+		require.Equal(t, entry.AuditLog.ID, id)
+		require.Equal(t, "workspace", logType)
+		require.Equal(t, "tea-123", ownerID)
+		require.Equal(t, entry.Cursor, cursor)
+		require.True(t, entry.AuditLog.Timestamp.Equal(timestamp))
+		require.Equal(t, "LoginEvent", event)
+		require.Equal(t, "success", status)
+		require.Equal(t, "test@example.com", email)
+		if i == 1 {
+			require.Equal(t, "srv-123", *serviceID)
+		} else {
+			require.Nil(t, serviceID)
+		}
+		i++
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, 3, i)
+}
+
+func TestUploadAuditLogsIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	pool := newPool(t)
+
+	s, err := postgres.NewSink(ctx, pool)
+	require.NoError(t, err)
+
+	testData := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC))
+
+	_, err = s.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testData)
+	require.NoError(t, err)
+
+	// Re-uploading a page, including a duplicate entry, doesn't add rows
+	testData[0].AuditLog.Status = "failure"
+	_, err = s.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", append(testData, testData[2]))
+	require.NoError(t, err)
+
+	var count int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM render_audit_logs`).Scan(&count))
+	require.Equal(t, 3, count)
+
+	var status string
+	require.NoError(t, pool.QueryRow(ctx, `SELECT status FROM render_audit_logs WHERE id = $1`, testData[0].AuditLog.ID).Scan(&status))
+	require.Equal(t, "failure", status)
+}
+
+func TestUploadAuditLogsSavesCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	pool := newPool(t)
+
+	s, err := postgres.NewSink(ctx, pool)
+	require.NoError(t, err)
+
+	cp, err := s.LoadCheckpoint(ctx, auditlogs.OrganizationAuditLog, "org-456")
+	require.NoError(t, err)
+	require.Nil(t, cp)
+
+	testData := testhelpers.CreateTestAuditLogs(3, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC))
+	_, err = s.UploadAuditLogs(ctx, auditlogs.OrganizationAuditLog, "org-456", testData)
+	require.NoError(t, err)
+
+	cp, err = s.LoadCheckpoint(ctx, auditlogs.OrganizationAuditLog, "org-456")
+	require.NoError(t, err)
+	require.Equal(t, &checkpoint.Checkpoint{
+		LastCursor:    testData[2].Cursor,
+		LastTimestamp: testData[2].AuditLog.Timestamp,
+	}, cp)
+
+	// Checkpoints are kept per log type and owner
+	cp, err = s.LoadCheckpoint(ctx, auditlogs.WorkspaceAuditLog, "org-456")
+	require.NoError(t, err)
+	require.Nil(t, cp)
+
+	next := &checkpoint.Checkpoint{LastCursor: "next-cursor", LastTimestamp: time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)}
+	require.NoError(t, s.SaveCheckpoint(ctx, next, auditlogs.OrganizationAuditLog, "org-456"))
+
+	cp, err = s.LoadCheckpoint(ctx, auditlogs.OrganizationAuditLog, "org-456")
+	require.NoError(t, err)
+	require.Equal(t, next, cp)
+}
+
+func TestNewSinkMigratesOnce(t *testing.T) {
+	ctx := context.Background()
+	pool := newPool(t)
+
+	for range 2 {
+		_, err := postgres.NewSink(ctx, pool)
+		require.NoError(t, err)
+	}
+
+	var versions int
+	require.NoError(t, pool.QueryRow(ctx, `SELECT count(*) FROM render_audit_logs_schema_migrations`).Scan(&versions))
+	require.Equal(t, 3, versions)
+}
@@ -3,33 +3,49 @@ package processor
 import (
 	"context"
 	"fmt"
-	"time"
 
+	"github.com/renderinc/render-auditlogs/pkg/archive"
 	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
-	"github.com/renderinc/render-auditlogs/pkg/aws"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
 	"github.com/renderinc/render-auditlogs/pkg/logger"
 	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/sink"
 )
 
 const (
 	pageSize int = 1000
 )
 
-type Uploader interface {
-	LoadCheckpoint(ctx context.Context, logType auditlogs.LogType, id string) (*aws.Checkpoint, error)
-	SaveCheckpoint(ctx context.Context, cp *aws.Checkpoint, logType auditlogs.LogType, id string) error
-	UploadAuditLogs(ctx context.Context, logType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error)
+type Options struct {
+	// Partition is the time span audit logs are batched by before being
+	// uploaded, matching the sink's key partitions. Defaults to a day.
+	Partition archive.Granularity
+	// SplitByEvent uploads each event's audit logs in a window separately,
+	// for sinks whose keys contain the event name
+	SplitByEvent bool
 }
 
 type LogProcessor struct {
-	uploader    Uploader
+	sink        sink.Sink
+	checkpoints checkpoint.Store
 	auditLogSvc auditlogs.Service
+	opts        Options
 }
 
-func NewLogProcessor(uploader Uploader, auditLogSvc auditlogs.Service) *LogProcessor {
+func NewLogProcessor(sink sink.Sink, checkpoints checkpoint.Store, auditLogSvc auditlogs.Service) *LogProcessor {
+	return NewLogProcessorWithOptions(sink, checkpoints, auditLogSvc, Options{})
+}
+
+func NewLogProcessorWithOptions(sink sink.Sink, checkpoints checkpoint.Store, auditLogSvc auditlogs.Service, opts Options) *LogProcessor {
+	if opts.Partition == "" {
+		opts.Partition = archive.GranularityDay
+	}
+
 	return &LogProcessor{
-		uploader:    uploader,
+		sink:        sink,
+		checkpoints: checkpoints,
 		auditLogSvc: auditLogSvc,
+		opts:        opts,
 	}
 }
 
@@ -38,21 +54,27 @@ func (lp *LogProcessor) Process(ctx context.Context, id string) error {
 
 	cursor := ""
 
-	checkpoint, err := lp.getLastCheckpoint(ctx, id)
+	cp, err := lp.getLastCheckpoint(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	if checkpoint != nil {
-		cursor = checkpoint.LastCursor
+	if cp != nil {
+		cursor = cp.LastCursor
 	}
 
-	var finalAuditLog *render.AuditLogEntry
-
 	for {
 		lastAuditLog, err := lp.processPage(ctx, id, cursor)
 		if err != nil {
-			return fmt.Errorf("error processing workspace page: %w", err)
+			switch {
+			case render.IsNotFound(err):
+				l.Warn("audit logs not found, skipping", "error", err)
+				return nil
+			case render.IsInvalidCursor(err):
+				return fmt.Errorf("checkpoint cursor %q was rejected, remove the checkpoint to start over: %w", cursor, err)
+			default:
+				return fmt.Errorf("error processing workspace page: %w", err)
+			}
 		}
 
 		if lastAuditLog == nil {
@@ -60,35 +82,25 @@ func (lp *LogProcessor) Process(ctx context.Context, id string) error {
 		}
 
 		cursor = lastAuditLog.Cursor
-		finalAuditLog = lastAuditLog
 	}
 
-	l.Info("final cursor processed", "finalAuditLog", finalAuditLog)
-
-	if finalAuditLog != nil {
-		newCheckpoint := &aws.Checkpoint{
-			LastCursor:    finalAuditLog.Cursor,
-			LastTimestamp: finalAuditLog.AuditLog.Timestamp,
-		}
-		return lp.updateLastCheckpoint(ctx, id, newCheckpoint)
-	}
+	l.Info("final cursor processed", "cursor", cursor)
 
 	return nil
 }
 
-func (lp *LogProcessor) getLastCheckpoint(ctx context.Context, id string) (*aws.Checkpoint, error) {
-	// Load checkpoint from S3
-	checkpoint, err := lp.uploader.LoadCheckpoint(ctx, lp.auditLogSvc.Type(), id)
+func (lp *LogProcessor) getLastCheckpoint(ctx context.Context, id string) (*checkpoint.Checkpoint, error) {
+	cp, err := lp.checkpoints.LoadCheckpoint(ctx, lp.auditLogSvc.Type(), id)
 	if err != nil {
 		return nil, err
 	}
 
-	return checkpoint, nil
+	return cp, nil
 }
 
-func (lp *LogProcessor) updateLastCheckpoint(ctx context.Context, id string, cp *aws.Checkpoint) error {
+func (lp *LogProcessor) updateLastCheckpoint(ctx context.Context, id string, cp *checkpoint.Checkpoint) error {
 	logger.FromContext(ctx).Info("updating checkpoint")
-	if err := lp.uploader.SaveCheckpoint(ctx, cp, lp.auditLogSvc.Type(), id); err != nil {
+	if err := lp.checkpoints.SaveCheckpoint(ctx, cp, lp.auditLogSvc.Type(), id); err != nil {
 		return fmt.Errorf("error saving checkpoint: %w", err)
 	}
 	return nil
@@ -99,6 +111,7 @@ func (lp *LogProcessor) processPage(ctx context.Context, id string, cursor strin
 
 	// Fetch audit logs
 	auditLogs, err := lp.auditLogSvc.Get(
+		ctx,
 		id,
 		cursor,
 		pageSize)
@@ -112,53 +125,91 @@ func (lp *LogProcessor) processPage(ctx context.Context, id string, cursor strin
 		return nil, nil
 	}
 
-	cursorDay := time.Date(
-		auditLogs[0].AuditLog.Timestamp.Year(),
-		auditLogs[0].AuditLog.Timestamp.Month(),
-		auditLogs[0].AuditLog.Timestamp.Day(),
-		0, 0, 0, 0, time.UTC,
-	)
-
+	// Split the page into windows of consecutive audit logs in the same
+	// partition
+	partition := lp.opts.Partition.Truncate(auditLogs[0].AuditLog.Timestamp)
 	windowStart := 0
 
 	for i, auditLog := range auditLogs {
-		if auditLog.AuditLog.Timestamp.After(cursorDay.Add(24 * time.Hour)) {
-			l.Info("upload", "start", windowStart, "end", i)
-
-			s3URI, err := lp.uploader.UploadAuditLogs(
-				ctx,
-				lp.auditLogSvc.Type(),
-				id,
-				auditLogs[windowStart:i],
-			)
-			if err != nil {
-				l.Error("error uploading to S3", "error", err)
+		if p := lp.opts.Partition.Truncate(auditLog.AuditLog.Timestamp); !p.Equal(partition) {
+			if err := lp.uploadWindow(ctx, id, auditLogs[windowStart:i]); err != nil {
 				return nil, err
 			}
-			l.Info("audit logs uploaded", "s3URI", s3URI)
 
 			windowStart = i
-			cursorDay = cursorDay.Add(time.Hour * 24)
+			partition = p
 		}
 	}
 
 	if len(auditLogs[windowStart:]) > 0 {
-		l.Info("upload", "start", windowStart, "end", len(auditLogs))
+		if err := lp.uploadWindow(ctx, id, auditLogs[windowStart:]); err != nil {
+			return nil, err
+		}
+	}
 
-		s3URI, err := lp.uploader.UploadAuditLogs(
-			ctx,
-			lp.auditLogSvc.Type(),
-			id,
-			auditLogs[windowStart:],
-		)
+	return &auditLogs[len(auditLogs)-1], nil
+}
 
-		if err != nil {
-			l.Error("error uploading to S3:", "error", err)
-			return nil, err
+// uploadWindow uploads a single window of audit logs and then advances the
+// checkpoint to its last entry, so an interrupted run resumes after the last
+// window that is durably stored. When split by event, the checkpoint only
+// advances once every event's batch is stored, and a retry re-uploads the
+// same batches.
+func (lp *LogProcessor) uploadWindow(ctx context.Context, id string, window []render.AuditLogEntry) error {
+	batches := [][]render.AuditLogEntry{window}
+	if lp.opts.SplitByEvent {
+		batches = splitByEvent(window)
+	}
+
+	for _, batch := range batches {
+		if err := lp.uploadBatch(ctx, id, batch); err != nil {
+			return err
 		}
-		l.Info("audit logs uploaded to", "s3URI", s3URI)
+	}
+
+	last := window[len(window)-1]
+
+	return lp.updateLastCheckpoint(ctx, id, &checkpoint.Checkpoint{
+		LastCursor:    last.Cursor,
+		LastTimestamp: last.AuditLog.Timestamp,
+	})
+}
 
+func (lp *LogProcessor) uploadBatch(ctx context.Context, id string, batch []render.AuditLogEntry) error {
+	l := logger.FromContext(ctx)
+
+	l.Info("upload", "count", len(batch))
+
+	location, err := lp.sink.UploadAuditLogs(
+		ctx,
+		lp.auditLogSvc.Type(),
+		id,
+		batch,
+	)
+	if err != nil {
+		l.Error("error uploading audit logs", "error", err)
+		return err
 	}
+	l.Info("audit logs uploaded", "location", location)
 
-	return &auditLogs[len(auditLogs)-1], nil
+	return nil
+}
+
+// splitByEvent groups audit logs by event, keeping each event's audit logs in
+// order and the events in order of first appearance
+func splitByEvent(window []render.AuditLogEntry) [][]render.AuditLogEntry {
+	var batches [][]render.AuditLogEntry
+	index := make(map[string]int)
+
+	for _, auditLog := range window {
+		i, ok := index[auditLog.AuditLog.Event]
+		if !ok {
+			i = len(batches)
+			index[auditLog.AuditLog.Event] = i
+			batches = append(batches, nil)
+		}
+		batches[i] = append(batches[i], auditLog)
+	}
+
+	return batches
 }
@@ -3,31 +3,42 @@ package processor_test
 import (
 	"context"
 	"errors"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/renderinc/render-auditlogs/pkg/archive"
 	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
-	"github.com/renderinc/render-auditlogs/pkg/aws"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
 	"github.com/renderinc/render-auditlogs/pkg/processor"
 	"github.com/renderinc/render-auditlogs/pkg/render"
 	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
 )
 
 type mockUploader struct {
-	lastCheckpoint *aws.Checkpoint
+	lastCheckpoint *checkpoint.Checkpoint
 	s3Error        error
 	numUploads     int
+	numCheckpoints int
+
+	// failAfterUploads makes every upload after the given number fail.
+	failAfterUploads int
 }
 
-func (m *mockUploader) LoadCheckpoint(ctx context.Context, logType auditlogs.LogType, id string) (*aws.Checkpoint, error) {
+func (m *mockUploader) LoadCheckpoint(ctx context.Context, logType auditlogs.LogType, id string) (*checkpoint.Checkpoint, error) {
 	return m.lastCheckpoint, m.s3Error
 }
 
-func (m *mockUploader) SaveCheckpoint(ctx context.Context, cp *aws.Checkpoint, logType auditlogs.LogType, id string) error {
+func (m *mockUploader) SaveCheckpoint(ctx context.Context, cp *checkpoint.Checkpoint, logType auditlogs.LogType, id string) error {
+	if m.s3Error != nil {
+		return m.s3Error
+	}
+
+	m.numCheckpoints++
 	m.lastCheckpoint = cp
-	return m.s3Error
+	return nil
 }
 
 func (m *mockUploader) UploadAuditLogs(ctx context.Context, logType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
@@ -35,6 +46,10 @@ func (m *mockUploader) UploadAuditLogs(ctx context.Context, logType auditlogs.Lo
 		return "", m.s3Error
 	}
 
+	if m.failAfterUploads > 0 && m.numUploads >= m.failAfterUploads {
+		return "", errors.New("upload failed")
+	}
+
 	m.numUploads++
 	return "s3://bucket/key", nil
 }
@@ -45,7 +60,7 @@ type mockAuditLogService struct {
 	renderError error
 }
 
-func (m *mockAuditLogService) Get(id string, cursor string, limit int) ([]render.AuditLogEntry, error) {
+func (m *mockAuditLogService) Get(ctx context.Context, id string, cursor string, limit int) ([]render.AuditLogEntry, error) {
 	if m.renderError != nil {
 		return nil, m.renderError
 	}
@@ -80,13 +95,13 @@ func TestProcess(t *testing.T) {
 
 		ctx := t.Context()
 		uploader := &mockUploader{
-			lastCheckpoint: &aws.Checkpoint{LastCursor: "cursor-123"},
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "cursor-123"},
 		}
 		service := &mockAuditLogService{
 			auditLogs: testhelpers.CreateTestAuditLogs(0, today()),
 		}
 
-		lp := processor.NewLogProcessor(uploader, service)
+		lp := processor.NewLogProcessor(uploader, uploader, service)
 
 		err := lp.Process(ctx, "workspace-123")
 		require.NoError(t, err)
@@ -95,7 +110,7 @@ func TestProcess(t *testing.T) {
 
 	t.Run("LogsWithinSameDay", func(t *testing.T) {
 		uploader := &mockUploader{
-			lastCheckpoint: &aws.Checkpoint{LastCursor: "0"},
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "0"},
 		}
 
 		logs := testhelpers.CreateTestAuditLogs(3, today())
@@ -105,7 +120,7 @@ func TestProcess(t *testing.T) {
 			logType:   auditlogs.WorkspaceAuditLog,
 		}
 
-		lp := processor.NewLogProcessor(uploader, service)
+		lp := processor.NewLogProcessor(uploader, uploader, service)
 		ctx := t.Context()
 
 		err := lp.Process(ctx, "workspace-123")
@@ -117,7 +132,7 @@ func TestProcess(t *testing.T) {
 
 	t.Run("MultiplePages", func(t *testing.T) {
 		uploader := &mockUploader{
-			lastCheckpoint: &aws.Checkpoint{LastCursor: "0"},
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "0"},
 		}
 
 		logs := testhelpers.CreateTestAuditLogs(1005, today())
@@ -127,7 +142,7 @@ func TestProcess(t *testing.T) {
 			logType:   auditlogs.WorkspaceAuditLog,
 		}
 
-		lp := processor.NewLogProcessor(uploader, service)
+		lp := processor.NewLogProcessor(uploader, uploader, service)
 		ctx := t.Context()
 
 		err := lp.Process(ctx, "workspace-123")
@@ -139,7 +154,7 @@ func TestProcess(t *testing.T) {
 
 	t.Run("MultipleDays", func(t *testing.T) {
 		uploader := &mockUploader{
-			lastCheckpoint: &aws.Checkpoint{LastCursor: "0"},
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "0"},
 		}
 
 		logs := append(
@@ -152,19 +167,118 @@ func TestProcess(t *testing.T) {
 			logType:   auditlogs.WorkspaceAuditLog,
 		}
 
-		lp := processor.NewLogProcessor(uploader, service)
+		lp := processor.NewLogProcessor(uploader, uploader, service)
 		ctx := t.Context()
 
 		err := lp.Process(ctx, "workspace-123")
 		require.NoError(t, err)
 
+		require.Equal(t, 2, uploader.numUploads)
+		require.Equal(t, 2, uploader.numCheckpoints)
+		require.Equal(t, logs[5].Cursor, uploader.lastCheckpoint.LastCursor)
+	})
+
+	t.Run("DaysApart", func(t *testing.T) {
+		uploader := &mockUploader{
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "0"},
+		}
+
+		// Later audit logs all land in one window however far apart the days are
+		logs := append(
+			testhelpers.CreateTestAuditLogs(3, today().AddDate(0, 0, -5)),
+			testhelpers.CreateTestAuditLogs(3, today())...,
+		)
+
+		service := &mockAuditLogService{
+			auditLogs: logs,
+			logType:   auditlogs.WorkspaceAuditLog,
+		}
+
+		lp := processor.NewLogProcessor(uploader, uploader, service)
+
+		err := lp.Process(t.Context(), "workspace-123")
+		require.NoError(t, err)
+
 		require.Equal(t, 2, uploader.numUploads)
 		require.Equal(t, logs[5].Cursor, uploader.lastCheckpoint.LastCursor)
 	})
 
+	t.Run("MultipleHours", func(t *testing.T) {
+		uploader := &mockUploader{
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "0"},
+		}
+
+		// 150 audit logs a minute apart span three hours
+		logs := testhelpers.CreateTestAuditLogs(150, today())
+
+		service := &mockAuditLogService{
+			auditLogs: logs,
+			logType:   auditlogs.WorkspaceAuditLog,
+		}
+
+		lp := processor.NewLogProcessorWithOptions(uploader, uploader, service, processor.Options{Partition: archive.GranularityHour})
+
+		err := lp.Process(t.Context(), "workspace-123")
+		require.NoError(t, err)
+
+		require.Equal(t, 3, uploader.numUploads)
+		require.Equal(t, 3, uploader.numCheckpoints)
+		require.Equal(t, logs[149].Cursor, uploader.lastCheckpoint.LastCursor)
+	})
+
+	t.Run("SplitByEvent", func(t *testing.T) {
+		uploader := &mockUploader{
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "0"},
+		}
+
+		logs := testhelpers.CreateTestAuditLogs(5, today())
+		logs[1].AuditLog.Event = "ServiceCreated"
+		logs[3].AuditLog.Event = "ServiceCreated"
+
+		service := &mockAuditLogService{
+			auditLogs: logs,
+			logType:   auditlogs.WorkspaceAuditLog,
+		}
+
+		lp := processor.NewLogProcessorWithOptions(uploader, uploader, service, processor.Options{SplitByEvent: true})
+
+		err := lp.Process(t.Context(), "workspace-123")
+		require.NoError(t, err)
+
+		// One upload per event, and one checkpoint once both are stored
+		require.Equal(t, 2, uploader.numUploads)
+		require.Equal(t, 1, uploader.numCheckpoints)
+		require.Equal(t, logs[4].Cursor, uploader.lastCheckpoint.LastCursor)
+	})
+
+	t.Run("ErrorUploadingLaterPage", func(t *testing.T) {
+		uploader := &mockUploader{
+			lastCheckpoint:   &checkpoint.Checkpoint{LastCursor: "0"},
+			failAfterUploads: 1,
+		}
+
+		logs := testhelpers.CreateTestAuditLogs(1005, today())
+
+		service := &mockAuditLogService{
+			auditLogs: logs,
+			logType:   auditlogs.WorkspaceAuditLog,
+		}
+
+		lp := processor.NewLogProcessor(uploader, uploader, service)
+		ctx := t.Context()
+
+		err := lp.Process(ctx, "workspace-123")
+		require.Error(t, err)
+
+		// the first page is durably uploaded, so the checkpoint points at its last entry
+		require.Equal(t, 1, uploader.numUploads)
+		require.Equal(t, logs[999].Cursor, uploader.lastCheckpoint.LastCursor)
+		require.Equal(t, logs[999].AuditLog.Timestamp, uploader.lastCheckpoint.LastTimestamp)
+	})
+
 	t.Run("ErrorFetchingAuditLogs", func(t *testing.T) {
 		uploader := &mockUploader{
-			lastCheckpoint: &aws.Checkpoint{LastCursor: "0"},
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "0"},
 		}
 
 		logs := testhelpers.CreateTestAuditLogs(3, today())
@@ -175,7 +289,7 @@ func TestProcess(t *testing.T) {
 			renderError: errors.New("cannot get logs"),
 		}
 
-		lp := processor.NewLogProcessor(uploader, service)
+		lp := processor.NewLogProcessor(uploader, uploader, service)
 		ctx := t.Context()
 
 		err := lp.Process(ctx, "workspace-123")
@@ -185,9 +299,47 @@ func TestProcess(t *testing.T) {
 		require.Equal(t, "0", uploader.lastCheckpoint.LastCursor)
 	})
 
+	t.Run("WorkspaceNotFound", func(t *testing.T) {
+		uploader := &mockUploader{
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "0"},
+		}
+
+		service := &mockAuditLogService{
+			logType:     auditlogs.WorkspaceAuditLog,
+			renderError: &render.APIError{StatusCode: http.StatusNotFound, Message: "owner not found"},
+		}
+
+		lp := processor.NewLogProcessor(uploader, uploader, service)
+		ctx := t.Context()
+
+		err := lp.Process(ctx, "workspace-123")
+		require.NoError(t, err)
+		require.Equal(t, 0, uploader.numUploads)
+	})
+
+	t.Run("InvalidCursor", func(t *testing.T) {
+		uploader := &mockUploader{
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "stale-cursor"},
+		}
+
+		service := &mockAuditLogService{
+			logType:     auditlogs.WorkspaceAuditLog,
+			renderError: &render.APIError{StatusCode: http.StatusBadRequest, Message: "invalid cursor"},
+		}
+
+		lp := processor.NewLogProcessor(uploader, uploader, service)
+		ctx := t.Context()
+
+		err := lp.Process(ctx, "workspace-123")
+		require.Error(t, err)
+		require.True(t, render.IsInvalidCursor(err))
+		require.Contains(t, err.Error(), "stale-cursor")
+		require.Equal(t, "stale-cursor", uploader.lastCheckpoint.LastCursor)
+	})
+
 	t.Run("ErrorUploading", func(t *testing.T) {
 		uploader := &mockUploader{
-			lastCheckpoint: &aws.Checkpoint{LastCursor: "0"},
+			lastCheckpoint: &checkpoint.Checkpoint{LastCursor: "0"},
 
 			s3Error: errors.New("cannot access s3"),
 		}
@@ -199,7 +351,7 @@ func TestProcess(t *testing.T) {
 			logType:   auditlogs.WorkspaceAuditLog,
 		}
 
-		lp := processor.NewLogProcessor(uploader, service)
+		lp := processor.NewLogProcessor(uploader, uploader, service)
 		ctx := t.Context()
 
 		err := lp.Process(ctx, "workspace-123")
@@ -219,7 +371,7 @@ func TestProcess(t *testing.T) {
 			logType:   auditlogs.WorkspaceAuditLog,
 		}
 
-		lp := processor.NewLogProcessor(uploader, service)
+		lp := processor.NewLogProcessor(uploader, uploader, service)
 		ctx := t.Context()
 
 		err := lp.Process(ctx, "workspace-123")
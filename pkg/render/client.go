@@ -1,12 +1,19 @@
 package render
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
 )
 
 type Actor struct {
@@ -29,23 +36,42 @@ type AuditLogEntry struct {
 	AuditLog AuditLog `json:"auditLog"`
 }
 
+// RetryPolicy controls how transient API failures are retried
+type RetryPolicy = retry.Policy
+
+type ClientOptions struct {
+	// Timeout bounds a single HTTP attempt
+	Timeout time.Duration
+	Retry   RetryPolicy
+}
+
 type Client struct {
 	apiKey     string
 	httpClient *http.Client
 	baseURL    string
+	retry      RetryPolicy
 }
 
 func NewClient(baseURL, apiKey string) *Client {
+	return NewClientWithOptions(baseURL, apiKey, ClientOptions{})
+}
+
+func NewClientWithOptions(baseURL, apiKey string, opts ClientOptions) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
 	return &Client{
 		apiKey:  apiKey,
 		baseURL: baseURL,
+		retry:   opts.Retry,
 		httpClient: &http.Client{
-			Timeout: 5 * time.Second,
+			Timeout: opts.Timeout,
 		},
 	}
 }
 
-func (c *Client) GetAuditLogs(endpoint string, cursor string, limit int) ([]AuditLogEntry, error) {
+func (c *Client) GetAuditLogs(ctx context.Context, endpoint string, cursor string, limit int) ([]AuditLogEntry, error) {
 	u, err := url.Parse(c.baseURL + endpoint)
 	if err != nil {
 		return nil, err
@@ -59,7 +85,40 @@ func (c *Client) GetAuditLogs(endpoint string, cursor string, limit int) ([]Audi
 
 	u.RawQuery = q.Encode()
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+	body, err := c.get(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var auditLogs []AuditLogEntry
+	err = json.Unmarshal(body, &auditLogs)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing JSON response: %w", err)
+	}
+
+	return auditLogs, nil
+}
+
+// get performs a GET request, retrying transient failures according to the
+// client's retry policy. It returns the body of the first successful response.
+func (c *Client) get(ctx context.Context, rawURL string) ([]byte, error) {
+	var body []byte
+
+	err := retry.Do(ctx, c.retry, func() error {
+		var err error
+		body, err = c.doGet(ctx, rawURL)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// doGet performs a single attempt, marking transient failures as retryable
+func (c *Client) doGet(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -69,24 +128,23 @@ func (c *Client) GetAuditLogs(endpoint string, cursor string, limit int) ([]Audi
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+		return nil, retry.Retryable(fmt.Errorf("error making request: %w", err), 0)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
-	}
-
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+		return nil, retry.Retryable(fmt.Errorf("error reading response body: %w", err), 0)
 	}
 
-	var auditLogs []AuditLogEntry
-	err = json.Unmarshal(body, &auditLogs)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing JSON response: %w", err)
+	if resp.StatusCode == http.StatusOK {
+		return body, nil
 	}
 
-	return auditLogs, nil
+	apiErr := newAPIError(resp, body)
+	if retry.IsRetryableStatus(resp.StatusCode) {
+		return nil, retry.Retryable(apiErr, retry.RetryAfter(resp.Header))
+	}
+
+	return nil, apiErr
 }
@@ -1,9 +1,11 @@
 package render_test
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -87,7 +89,7 @@ func TestClient_GetAuditLogs(t *testing.T) {
 	t.Run("successful request with audit logs", func(t *testing.T) {
 		client := render.NewClient(server.URL, "test-api-key")
 
-		logs, err := client.GetAuditLogs("/owners/workspace-123/audit-logs", "", 50)
+		logs, err := client.GetAuditLogs(t.Context(), "/owners/workspace-123/audit-logs", "", 50)
 		require.NoError(t, err)
 		require.Len(t, logs, 2)
 		require.Equal(t, "cursor-1", logs[0].Cursor)
@@ -97,7 +99,7 @@ func TestClient_GetAuditLogs(t *testing.T) {
 	t.Run("successful request with no logs", func(t *testing.T) {
 		client := render.NewClient(server.URL, "test-api-key")
 
-		logs, err := client.GetAuditLogs("/owners/workspace-123/audit-logs", "cursor-2", 50)
+		logs, err := client.GetAuditLogs(t.Context(), "/owners/workspace-123/audit-logs", "cursor-2", 50)
 		require.NoError(t, err)
 		require.Len(t, logs, 0)
 	})
@@ -105,8 +107,123 @@ func TestClient_GetAuditLogs(t *testing.T) {
 	t.Run("invalid api key", func(t *testing.T) {
 		client := render.NewClient(server.URL, "test-api-key-invalid")
 
-		logs, err := client.GetAuditLogs("/owners/workspace-123/audit-logs", "cursor-2", 50)
+		logs, err := client.GetAuditLogs(t.Context(), "/owners/workspace-123/audit-logs", "cursor-2", 50)
 		require.Error(t, err)
 		require.Len(t, logs, 0)
 	})
 }
+
+func TestClient_GetAuditLogsRetries(t *testing.T) {
+	t.Parallel()
+
+	opts := render.ClientOptions{
+		Retry: render.RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     5 * time.Millisecond,
+		},
+	}
+
+	// Requested delays are capped at the maximum backoff
+	slowOpts := opts
+	slowOpts.Retry.MaxBackoff = time.Minute
+
+	t.Run("retries server errors", func(t *testing.T) {
+		t.Parallel()
+		var attempts atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(workspaceLogs)
+		}))
+		defer server.Close()
+
+		client := render.NewClientWithOptions(server.URL, "test-api-key", opts)
+
+		logs, err := client.GetAuditLogs(t.Context(), "/owners/workspace-123/audit-logs", "", 50)
+		require.NoError(t, err)
+		require.Len(t, logs, 2)
+		require.Equal(t, int32(3), attempts.Load())
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		t.Parallel()
+		var attempts atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		client := render.NewClientWithOptions(server.URL, "test-api-key", opts)
+
+		_, err := client.GetAuditLogs(t.Context(), "/owners/workspace-123/audit-logs", "", 50)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "502")
+		require.Equal(t, int32(3), attempts.Load())
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		t.Parallel()
+		var attempts atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		client := render.NewClientWithOptions(server.URL, "test-api-key", opts)
+
+		_, err := client.GetAuditLogs(t.Context(), "/owners/workspace-123/audit-logs", "", 50)
+		require.Error(t, err)
+		require.Equal(t, int32(1), attempts.Load())
+	})
+
+	t.Run("honors Retry-After on rate limit", func(t *testing.T) {
+		t.Parallel()
+		var attempts atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(workspaceLogs)
+		}))
+		defer server.Close()
+
+		client := render.NewClientWithOptions(server.URL, "test-api-key", slowOpts)
+
+		start := time.Now()
+		logs, err := client.GetAuditLogs(t.Context(), "/owners/workspace-123/audit-logs", "", 50)
+		require.NoError(t, err)
+		require.Len(t, logs, 2)
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("stops retrying when the context is canceled", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		client := render.NewClientWithOptions(server.URL, "test-api-key", slowOpts)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := client.GetAuditLogs(ctx, "/owners/workspace-123/audit-logs", "", 50)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
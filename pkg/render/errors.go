@@ -0,0 +1,84 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const maxErrorBodyLength = 512
+
+// APIError is returned when the Render API responds with a non-200 status
+type APIError struct {
+	StatusCode int
+	RequestID  string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("API request failed with status: %d", e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request ID: %s)", e.RequestID)
+	}
+	return msg
+}
+
+// newAPIError builds an APIError from a failed response and its body
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+	}
+
+	var decoded struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &decoded); err == nil && decoded.Message != "" {
+		apiErr.Message = decoded.Message
+	} else {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > maxErrorBodyLength {
+			msg = msg[:maxErrorBodyLength]
+		}
+		apiErr.Message = msg
+	}
+
+	return apiErr
+}
+
+// IsUnauthorized reports whether err is an API error caused by a missing,
+// invalid or insufficiently privileged API key
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized) || hasStatus(err, http.StatusForbidden)
+}
+
+// IsNotFound reports whether err is an API error for a workspace or
+// organization that does not exist
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsRateLimited reports whether err is an API error caused by rate limiting
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// IsInvalidCursor reports whether err is an API error rejecting the
+// pagination cursor
+func IsInvalidCursor(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	return strings.Contains(strings.ToLower(apiErr.Message), "cursor")
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
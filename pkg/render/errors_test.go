@@ -0,0 +1,113 @@
+package render_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+func TestClient_GetAuditLogsErrors(t *testing.T) {
+	t.Parallel()
+
+	opts := render.ClientOptions{
+		Retry: render.RetryPolicy{
+			MaxAttempts:    1,
+			InitialBackoff: time.Millisecond,
+		},
+	}
+
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		expectedMessage string
+		unauthorized    bool
+		notFound        bool
+		rateLimited     bool
+		invalidCursor   bool
+	}{
+		{
+			name:            "unauthorized",
+			status:          http.StatusUnauthorized,
+			body:            `{"id":"unauthorized","message":"invalid API key"}`,
+			expectedMessage: "invalid API key",
+			unauthorized:    true,
+		},
+		{
+			name:            "forbidden",
+			status:          http.StatusForbidden,
+			body:            `{"message":"user is not an admin of this workspace"}`,
+			expectedMessage: "user is not an admin of this workspace",
+			unauthorized:    true,
+		},
+		{
+			name:            "not found",
+			status:          http.StatusNotFound,
+			body:            `{"message":"owner not found"}`,
+			expectedMessage: "owner not found",
+			notFound:        true,
+		},
+		{
+			name:            "rate limited",
+			status:          http.StatusTooManyRequests,
+			body:            `{"message":"rate limit exceeded"}`,
+			expectedMessage: "rate limit exceeded",
+			rateLimited:     true,
+		},
+		{
+			name:            "invalid cursor",
+			status:          http.StatusBadRequest,
+			body:            `{"message":"invalid cursor"}`,
+			expectedMessage: "invalid cursor",
+			invalidCursor:   true,
+		},
+		{
+			name:            "bad request",
+			status:          http.StatusBadRequest,
+			body:            `{"message":"limit must be at most 100"}`,
+			expectedMessage: "limit must be at most 100",
+		},
+		{
+			name:            "non-JSON body",
+			status:          http.StatusBadGateway,
+			body:            "upstream unavailable\n",
+			expectedMessage: "upstream unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-Id", "req-123")
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			client := render.NewClientWithOptions(server.URL, "test-api-key", opts)
+
+			_, err := client.GetAuditLogs(t.Context(), "/owners/workspace-123/audit-logs", "cursor-1", 50)
+			require.Error(t, err)
+
+			var apiErr *render.APIError
+			require.ErrorAs(t, err, &apiErr)
+			require.Equal(t, tt.status, apiErr.StatusCode)
+			require.Equal(t, "req-123", apiErr.RequestID)
+			require.Equal(t, tt.expectedMessage, apiErr.Message)
+
+			wrapped := fmt.Errorf("error fetching audit logs %w", err)
+			require.Equal(t, tt.unauthorized, render.IsUnauthorized(wrapped))
+			require.Equal(t, tt.notFound, render.IsNotFound(wrapped))
+			require.Equal(t, tt.rateLimited, render.IsRateLimited(wrapped))
+			require.Equal(t, tt.invalidCursor, render.IsInvalidCursor(wrapped))
+		})
+	}
+}
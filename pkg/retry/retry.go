@@ -0,0 +1,138 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/renderinc/render-auditlogs/pkg/logger"
+)
+
+const (
+	defaultMaxAttempts    = 4
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// Policy controls how transient failures are retried.
+// Zero values fall back to the package defaults.
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks err as transient. If after is positive, the next attempt
+// waits for that long instead of the policy's backoff, capped at the policy's
+// maximum backoff.
+func Retryable(err error, after time.Duration) error {
+	return &retryableError{err: err, after: after}
+}
+
+// Do calls fn until it succeeds, returns an error not marked with Retryable,
+// the policy's attempts are exhausted or ctx is done.
+func Do(ctx context.Context, p Policy, fn func() error) error {
+	p = p.withDefaults()
+	l := logger.FromContext(ctx)
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var re *retryableError
+		if !errors.As(err, &re) || attempt >= p.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		// A delay requested by the server is capped so that a large
+		// Retry-After can't stall the run
+		wait := min(re.after, p.MaxBackoff)
+		if wait <= 0 {
+			wait = p.backoff(attempt)
+		}
+
+		l.Warn("retrying request", "attempt", attempt, "wait", wait, "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// IsRetryableStatus reports whether an HTTP status code indicates a transient
+// failure
+func IsRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// RetryAfter reads the delay requested by the server from the Retry-After
+// header, falling back to the Ratelimit-Reset header. It returns zero if
+// neither is present or parseable.
+func RetryAfter(h http.Header) time.Duration {
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if d := time.Until(t); d > 0 {
+				return d
+			}
+		}
+	}
+
+	if v := h.Get("Ratelimit-Reset"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+
+	return 0
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultMaxBackoff
+	}
+	return p
+}
+
+// backoff returns the exponential backoff for the given attempt with equal
+// jitter, capped at the policy's maximum.
+func (p Policy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff << (attempt - 1)
+	if d <= 0 || d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	half := d / 2
+	return half + rand.N(half+1)
+}
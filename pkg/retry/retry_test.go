@@ -0,0 +1,111 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+func TestDo(t *testing.T) {
+	t.Parallel()
+
+	policy := retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	t.Run("retries retryable errors until success", func(t *testing.T) {
+		t.Parallel()
+		attempts := 0
+
+		err := retry.Do(t.Context(), policy, func() error {
+			attempts++
+			if attempts < 3 {
+				return retry.Retryable(errors.New("transient"), 0)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, attempts)
+	})
+
+	t.Run("stops on non-retryable errors", func(t *testing.T) {
+		t.Parallel()
+		attempts := 0
+		permanent := errors.New("permanent")
+
+		err := retry.Do(t.Context(), policy, func() error {
+			attempts++
+			return permanent
+		})
+		require.ErrorIs(t, err, permanent)
+		require.Equal(t, 1, attempts)
+	})
+
+	t.Run("returns the last error after max attempts", func(t *testing.T) {
+		t.Parallel()
+		attempts := 0
+		transient := errors.New("transient")
+
+		err := retry.Do(t.Context(), policy, func() error {
+			attempts++
+			return retry.Retryable(transient, 0)
+		})
+		require.ErrorIs(t, err, transient)
+		require.Equal(t, 3, attempts)
+	})
+
+	t.Run("caps the requested delay at the maximum backoff", func(t *testing.T) {
+		t.Parallel()
+		attempts := 0
+
+		start := time.Now()
+		err := retry.Do(t.Context(), policy, func() error {
+			attempts++
+			if attempts < 2 {
+				return retry.Retryable(errors.New("rate limited"), 24*time.Hour)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+
+		err := retry.Do(ctx, retry.Policy{MaxAttempts: 3, MaxBackoff: time.Hour}, func() error {
+			return retry.Retryable(errors.New("transient"), time.Minute)
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected time.Duration
+	}{
+		{name: "none", header: http.Header{}, expected: 0},
+		{name: "seconds", header: http.Header{"Retry-After": {"3"}}, expected: 3 * time.Second},
+		{name: "invalid", header: http.Header{"Retry-After": {"soon"}}, expected: 0},
+		{name: "rate limit reset", header: http.Header{"Ratelimit-Reset": {"7"}}, expected: 7 * time.Second},
+		{name: "retry after wins", header: http.Header{"Retry-After": {"2"}, "Ratelimit-Reset": {"7"}}, expected: 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.expected, retry.RetryAfter(tt.header))
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"context"
+
+	"github.com/renderinc/render-auditlogs/pkg/aws"
+	"github.com/renderinc/render-auditlogs/pkg/azure"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+	"github.com/renderinc/render-auditlogs/pkg/datadog"
+	"github.com/renderinc/render-auditlogs/pkg/elasticsearch"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/filesystem"
+	"github.com/renderinc/render-auditlogs/pkg/gcs"
+	"github.com/renderinc/render-auditlogs/pkg/kafka"
+	"github.com/renderinc/render-auditlogs/pkg/otlp"
+	"github.com/renderinc/render-auditlogs/pkg/postgres"
+	"github.com/renderinc/render-auditlogs/pkg/splunk"
+	"github.com/renderinc/render-auditlogs/pkg/syslog"
+	"github.com/renderinc/render-auditlogs/pkg/webhook"
+)
+
+// sinks maps the SINK config value to the destination it selects
+var sinks = map[string]Factory{
+	"s3": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return aws.NewUploaderFromConfig(ctx, cfg)
+	},
+	"filesystem": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return filesystem.NewSinkFromConfig(ctx, cfg)
+	},
+	"gcs": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return gcs.NewUploaderFromConfig(ctx, cfg)
+	},
+	"azure": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return azure.NewUploaderFromConfig(ctx, cfg)
+	},
+	"splunk": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return splunk.NewSinkFromConfig(ctx, cfg)
+	},
+	"datadog": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return datadog.NewSinkFromConfig(ctx, cfg)
+	},
+	"elasticsearch": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return elasticsearch.NewSinkFromConfig(ctx, cfg)
+	},
+	"kafka": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return kafka.NewSinkFromConfig(ctx, cfg)
+	},
+	"syslog": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return syslog.NewSinkFromConfig(ctx, cfg)
+	},
+	"webhook": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return webhook.NewSinkFromConfig(ctx, cfg)
+	},
+	"cloudwatch": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return aws.NewCloudWatchSinkFromConfig(ctx, cfg)
+	},
+	"firehose": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return aws.NewFirehoseSinkFromConfig(ctx, cfg)
+	},
+	"kinesis": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return aws.NewKinesisSinkFromConfig(ctx, cfg)
+	},
+	"postgres": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return postgres.NewSinkFromConfig(ctx, cfg)
+	},
+	"otlp": func(ctx context.Context, cfg *env.Config) (Sink, error) {
+		return otlp.NewSinkFromConfig(ctx, cfg)
+	},
+}
+
+// archiveSinks are the sinks that write objects laid out by the OBJECT_*
+// settings
+var archiveSinks = []string{"s3", "filesystem", "gcs", "azure"}
+
+// checkpointStores maps the CHECKPOINT_STORE config value to the store it
+// selects
+var checkpointStores = map[string]CheckpointStoreFactory{
+	"s3": func(ctx context.Context, cfg *env.Config) (checkpoint.Store, error) {
+		return aws.NewUploaderFromConfig(ctx, cfg)
+	},
+	"filesystem": func(ctx context.Context, cfg *env.Config) (checkpoint.Store, error) {
+		return filesystem.NewSinkFromConfig(ctx, cfg)
+	},
+	"gcs": func(ctx context.Context, cfg *env.Config) (checkpoint.Store, error) {
+		return gcs.NewUploaderFromConfig(ctx, cfg)
+	},
+	"azure": func(ctx context.Context, cfg *env.Config) (checkpoint.Store, error) {
+		return azure.NewUploaderFromConfig(ctx, cfg)
+	},
+	"postgres": func(ctx context.Context, cfg *env.Config) (checkpoint.Store, error) {
+		return postgres.NewSinkFromConfig(ctx, cfg)
+	},
+}
@@ -0,0 +1,69 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/checkpoint"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+)
+
+// Sink is a destination for audit logs
+type Sink interface {
+	// UploadAuditLogs durably writes a batch of audit logs and returns a
+	// description of where they were written
+	UploadAuditLogs(ctx context.Context, logType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error)
+}
+
+type Factory func(ctx context.Context, cfg *env.Config) (Sink, error)
+
+type CheckpointStoreFactory func(ctx context.Context, cfg *env.Config) (checkpoint.Store, error)
+
+// New creates the sink selected by cfg.Sink
+func New(ctx context.Context, cfg *env.Config) (Sink, error) {
+	factory, ok := sinks[cfg.Sink]
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %q, must be one of: %s", cfg.Sink, names(sinks))
+	}
+
+	return factory(ctx, cfg)
+}
+
+// IsArchive reports whether the sink selected by cfg.Sink writes objects, whose
+// partitioning and key layout the batches it is given must follow
+func IsArchive(cfg *env.Config) bool {
+	return slices.Contains(archiveSinks, cfg.Sink)
+}
+
+// NewCheckpointStore creates the checkpoint store selected by
+// cfg.CheckpointStore, defaulting to the store of the same name as the sink
+func NewCheckpointStore(ctx context.Context, cfg *env.Config) (checkpoint.Store, error) {
+	name := cfg.CheckpointStore
+	if name == "" {
+		name = cfg.Sink
+	}
+
+	factory, ok := checkpointStores[name]
+	if !ok && cfg.CheckpointStore == "" {
+		return nil, fmt.Errorf("sink %q cannot store checkpoints, set CHECKPOINT_STORE to one of: %s", name, names(checkpointStores))
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown checkpoint store %q, must be one of: %s", name, names(checkpointStores))
+	}
+
+	return factory(ctx, cfg)
+}
+
+func names[T any](registry map[string]T) string {
+	keys := make([]string, 0, len(registry))
+	for k := range registry {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,87 @@
+package sink_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/aws"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/filesystem"
+	"github.com/renderinc/render-auditlogs/pkg/sink"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	t.Run("creates the configured sink", func(t *testing.T) {
+		t.Parallel()
+
+		s, err := sink.New(t.Context(), &env.Config{Sink: "s3", S3Bucket: "test-bucket", AWSRegion: "us-west-2"})
+		require.NoError(t, err)
+		require.IsType(t, &aws.Uploader{}, s)
+	})
+
+	t.Run("returns error when sink is misconfigured", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := sink.New(t.Context(), &env.Config{Sink: "filesystem"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "FILESYSTEM_ROOT")
+	})
+
+	t.Run("returns error for unknown sink", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := sink.New(t.Context(), &env.Config{Sink: "unknown"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `unknown sink "unknown"`)
+		require.Contains(t, err.Error(), "s3")
+	})
+}
+
+func TestIsArchive(t *testing.T) {
+	require.True(t, sink.IsArchive(&env.Config{Sink: "s3"}))
+	require.True(t, sink.IsArchive(&env.Config{Sink: "filesystem"}))
+	require.False(t, sink.IsArchive(&env.Config{Sink: "postgres"}))
+}
+
+func TestNewCheckpointStore(t *testing.T) {
+	t.Parallel()
+
+	t.Run("defaults to the sink's store", func(t *testing.T) {
+		t.Parallel()
+
+		store, err := sink.NewCheckpointStore(t.Context(), &env.Config{Sink: "s3", S3Bucket: "test-bucket", AWSRegion: "us-west-2"})
+		require.NoError(t, err)
+		require.IsType(t, &aws.Uploader{}, store)
+	})
+
+	t.Run("uses the configured store", func(t *testing.T) {
+		t.Parallel()
+
+		store, err := sink.NewCheckpointStore(t.Context(), &env.Config{
+			Sink:            "s3",
+			CheckpointStore: "filesystem",
+			FilesystemRoot:  t.TempDir(),
+		})
+		require.NoError(t, err)
+		require.IsType(t, &filesystem.Sink{}, store)
+	})
+
+	t.Run("requires a store for sinks without one", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := sink.NewCheckpointStore(t.Context(), &env.Config{Sink: "splunk"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "set CHECKPOINT_STORE")
+	})
+
+	t.Run("returns error for unknown store", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := sink.NewCheckpointStore(t.Context(), &env.Config{Sink: "s3", CheckpointStore: "unknown"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `unknown checkpoint store "unknown"`)
+	})
+}
@@ -0,0 +1,275 @@
+package splunk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/httpclient"
+	"github.com/renderinc/render-auditlogs/pkg/logger"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+const (
+	eventPath = "/services/collector/event"
+	ackPath   = "/services/collector/ack"
+
+	defaultSource          = "render-auditlogs"
+	defaultSourceType      = "render:auditlog"
+	defaultBatchSize       = 100
+	defaultAckTimeout      = 2 * time.Minute
+	defaultAckPollInterval = 2 * time.Second
+	defaultTimeout         = 30 * time.Second
+)
+
+type SinkOptions struct {
+	Index      string
+	SourceType string
+	Source     string
+	// BatchSize is the maximum number of events sent per request
+	BatchSize int
+	Gzip      bool
+	// AckChannel enables indexer acknowledgment. UploadAuditLogs only returns
+	// once every batch has been acknowledged on this channel.
+	AckChannel      string
+	AckTimeout      time.Duration
+	AckPollInterval time.Duration
+	Retry           retry.Policy
+}
+
+// Sink sends audit logs to a Splunk HTTP Event Collector
+type Sink struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+	opts       SinkOptions
+}
+
+// event is a single HEC event
+type event struct {
+	Time       float64              `json:"time"`
+	Index      string               `json:"index,omitempty"`
+	Source     string               `json:"source,omitempty"`
+	SourceType string               `json:"sourcetype,omitempty"`
+	Event      render.AuditLogEntry `json:"event"`
+	Fields     map[string]string    `json:"fields,omitempty"`
+}
+
+// response is the body returned by HEC endpoints
+type response struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+func NewSinkFromConfig(ctx context.Context, cfg *env.Config) (*Sink, error) {
+	if cfg.SplunkHECURL == "" || cfg.SplunkHECToken == "" {
+		return nil, fmt.Errorf("SPLUNK_HEC_URL and SPLUNK_HEC_TOKEN are required for the splunk sink")
+	}
+
+	httpClient := &http.Client{Timeout: cfg.SinkRequestTimeout}
+
+	return NewSink(httpClient, cfg.SplunkHECURL, cfg.SplunkHECToken, SinkOptions{
+		Index:      cfg.SplunkIndex,
+		SourceType: cfg.SplunkSourcetype,
+		Source:     cfg.SplunkSource,
+		BatchSize:  cfg.SplunkBatchSize,
+		Gzip:       cfg.SplunkGzip,
+		AckChannel: cfg.SplunkAckChannel,
+		AckTimeout: cfg.SplunkAckTimeout,
+		Retry: retry.Policy{
+			MaxAttempts:    cfg.SinkRetryMaxAttempts,
+			InitialBackoff: cfg.SinkRetryInitialBackoff,
+			MaxBackoff:     cfg.SinkRetryMaxBackoff,
+		},
+	})
+}
+
+func NewSink(httpClient *http.Client, baseURL, token string, opts SinkOptions) (*Sink, error) {
+	httpClient = httpclient.WithTimeout(httpClient, defaultTimeout)
+	if opts.Source == "" {
+		opts.Source = defaultSource
+	}
+	if opts.SourceType == "" {
+		opts.SourceType = defaultSourceType
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = defaultAckTimeout
+	}
+	if opts.AckPollInterval <= 0 {
+		opts.AckPollInterval = defaultAckPollInterval
+	}
+
+	return &Sink{
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		opts:       opts,
+	}, nil
+}
+
+// UploadAuditLogs sends each audit log as an individual HEC event, in batches.
+// When indexer acknowledgment is enabled it waits for every batch to be
+// acknowledged before returning.
+func (s *Sink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	var ackIDs []int64
+
+	for start := 0; start < len(data); start += s.opts.BatchSize {
+		end := min(start+s.opts.BatchSize, len(data))
+
+		body, err := s.encodeBatch(auditLogType, id, data[start:end])
+		if err != nil {
+			return "", err
+		}
+
+		var resp response
+		if err := s.post(ctx, eventPath, body, s.opts.Gzip, &resp); err != nil {
+			return "", fmt.Errorf("error sending events to Splunk HEC: %w", err)
+		}
+
+		if s.opts.AckChannel != "" {
+			if resp.AckID == nil {
+				return "", fmt.Errorf("error sending events to Splunk HEC: no ackId returned, is indexer acknowledgment enabled on the token?")
+			}
+			ackIDs = append(ackIDs, *resp.AckID)
+		}
+	}
+
+	if len(ackIDs) > 0 {
+		if err := s.waitForAcks(ctx, ackIDs); err != nil {
+			return "", err
+		}
+	}
+
+	return s.baseURL + eventPath, nil
+}
+
+func (s *Sink) encodeBatch(auditLogType auditlogs.LogType, id string, batch []render.AuditLogEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	for _, entry := range batch {
+		err := enc.Encode(event{
+			Time:       float64(entry.AuditLog.Timestamp.UnixMilli()) / 1000,
+			Index:      s.opts.Index,
+			Source:     s.opts.Source,
+			SourceType: s.opts.SourceType,
+			Event:      entry,
+			Fields: map[string]string{
+				"log_type": string(auditLogType),
+				"owner_id": id,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling event: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// waitForAcks polls the ack endpoint until every ack ID has been indexed or
+// the ack timeout expires
+func (s *Sink) waitForAcks(ctx context.Context, ackIDs []int64) error {
+	l := logger.FromContext(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.AckTimeout)
+	defer cancel()
+
+	pending := map[int64]bool{}
+	for _, id := range ackIDs {
+		pending[id] = true
+	}
+
+	for {
+		ids := make([]int64, 0, len(pending))
+		for id := range pending {
+			ids = append(ids, id)
+		}
+
+		body, err := json.Marshal(map[string][]int64{"acks": ids})
+		if err != nil {
+			return fmt.Errorf("error marshaling ack request: %w", err)
+		}
+
+		var status struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		if err := s.post(ctx, ackPath, body, false, &status); err != nil {
+			return fmt.Errorf("error checking Splunk HEC acknowledgments: %w", err)
+		}
+
+		for _, id := range ids {
+			if status.Acks[fmt.Sprint(id)] {
+				delete(pending, id)
+			}
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		l.Debug("waiting for Splunk HEC acknowledgments", "pending", len(pending))
+
+		timer := time.NewTimer(s.opts.AckPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("timed out waiting for Splunk HEC acknowledgments, %d batches pending: %w", len(pending), ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// post sends body to the given HEC endpoint, retrying transient failures,
+// and decodes the response into out
+func (s *Sink) post(ctx context.Context, path string, body []byte, compress bool, out any) error {
+	if compress {
+		var err error
+		if body, err = httpclient.Gzip(body); err != nil {
+			return err
+		}
+	}
+
+	return retry.Do(ctx, s.opts.Retry, func() error {
+		return s.do(ctx, path, body, compress, out)
+	})
+}
+
+// do performs a single request
+func (s *Sink) do(ctx context.Context, path string, body []byte, compressed bool, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.opts.AckChannel != "" {
+		req.Header.Set("X-Splunk-Request-Channel", s.opts.AckChannel)
+	}
+
+	respBody, err := httpclient.Send(s.httpClient, req)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("error parsing HEC response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package splunk_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+	"github.com/renderinc/render-auditlogs/pkg/splunk"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+type hecEvent struct {
+	Time       float64           `json:"time"`
+	Index      string            `json:"index"`
+	Source     string            `json:"source"`
+	SourceType string            `json:"sourcetype"`
+	Fields     map[string]string `json:"fields"`
+	Event      struct {
+		Cursor   string `json:"cursor"`
+		AuditLog struct {
+			ID string `json:"id"`
+		} `json:"auditLog"`
+	} `json:"event"`
+}
+
+// fakeHEC implements the event and ack endpoints of the HTTP Event Collector
+type fakeHEC struct {
+	mu sync.Mutex
+
+	events    []hecEvent
+	requests  int
+	failFirst int
+	// ackAfterPolls is the number of ack polls before acks are reported
+	ackAfterPolls int
+	ackPolls      int
+	nextAckID     int
+	channels      []string
+}
+
+func (f *fakeHEC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Splunk test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"text":"Invalid authorization","code":3}`)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/services/collector/event":
+		f.requests++
+		if f.requests <= f.failFirst {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"text":"Server is busy","code":9}`)
+			return
+		}
+
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			var e hecEvent
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"text":"Invalid data format","code":6}`)
+				return
+			}
+			f.events = append(f.events, e)
+		}
+
+		if channel := r.Header.Get("X-Splunk-Request-Channel"); channel != "" {
+			f.channels = append(f.channels, channel)
+			fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, f.nextAckID)
+			f.nextAckID++
+			return
+		}
+		fmt.Fprint(w, `{"text":"Success","code":0}`)
+	case "/services/collector/ack":
+		var req struct {
+			Acks []int `json:"acks"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		f.ackPolls++
+		acks := map[string]bool{}
+		for _, id := range req.Acks {
+			acks[fmt.Sprint(id)] = f.ackPolls > f.ackAfterPolls
+		}
+		json.NewEncoder(w).Encode(map[string]any{"acks": acks})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestUploadAuditLogs(t *testing.T) {
+	t.Parallel()
+
+	testDate := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	testData := testhelpers.CreateTestAuditLogs(5, testDate)
+	fastRetry := retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	t.Run("sends each audit log as an event in batches", func(t *testing.T) {
+		t.Parallel()
+		hec := &fakeHEC{}
+		server := httptest.NewServer(hec)
+		defer server.Close()
+
+		sink, err := splunk.NewSink(server.Client(), server.URL, "test-token", splunk.SinkOptions{
+			Index:      "render",
+			SourceType: "render:audit",
+			BatchSize:  2,
+			Retry:      fastRetry,
+		})
+		require.NoError(t, err)
+
+		location, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+		require.Equal(t, server.URL+"/services/collector/event", location)
+
+		require.Equal(t, 3, hec.requests)
+		require.Len(t, hec.events, 5)
+		for i, e := range hec.events {
+			require.Equal(t, float64(testData[i].AuditLog.Timestamp.Unix()), e.Time)
+			require.Equal(t, "render", e.Index)
+			require.Equal(t, "render:audit", e.SourceType)
+			require.Equal(t, "render-auditlogs", e.Source)
+			require.Equal(t, testData[i].Cursor, e.Event.Cursor)
+			require.Equal(t, testData[i].AuditLog.ID, e.Event.AuditLog.ID)
+			require.Equal(t, map[string]string{"log_type": "workspace", "owner_id": "workspace-123"}, e.Fields)
+		}
+	})
+
+	t.Run("compresses requests with gzip", func(t *testing.T) {
+		t.Parallel()
+		hec := &fakeHEC{}
+		server := httptest.NewServer(hec)
+		defer server.Close()
+
+		sink, err := splunk.NewSink(server.Client(), server.URL, "test-token", splunk.SinkOptions{Gzip: true, Retry: fastRetry})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.OrganizationAuditLog, "org-456", testData)
+		require.NoError(t, err)
+		require.Len(t, hec.events, 5)
+		require.Equal(t, "organization", hec.events[0].Fields["log_type"])
+	})
+
+	t.Run("retries when HEC is busy", func(t *testing.T) {
+		t.Parallel()
+		hec := &fakeHEC{failFirst: 2}
+		server := httptest.NewServer(hec)
+		defer server.Close()
+
+		sink, err := splunk.NewSink(server.Client(), server.URL, "test-token", splunk.SinkOptions{Retry: fastRetry})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+		require.Equal(t, 3, hec.requests)
+		require.Len(t, hec.events, 5)
+	})
+
+	t.Run("does not retry rejected requests", func(t *testing.T) {
+		t.Parallel()
+		hec := &fakeHEC{}
+		server := httptest.NewServer(hec)
+		defer server.Close()
+
+		sink, err := splunk.NewSink(server.Client(), server.URL, "wrong-token", splunk.SinkOptions{Retry: fastRetry})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "Invalid authorization")
+	})
+
+	t.Run("waits for indexer acknowledgment", func(t *testing.T) {
+		t.Parallel()
+		hec := &fakeHEC{ackAfterPolls: 2}
+		server := httptest.NewServer(hec)
+		defer server.Close()
+
+		sink, err := splunk.NewSink(server.Client(), server.URL, "test-token", splunk.SinkOptions{
+			BatchSize:       2,
+			AckChannel:      "11111111-2222-3333-4444-555555555555",
+			AckPollInterval: time.Millisecond,
+			Retry:           fastRetry,
+		})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.NoError(t, err)
+		require.Equal(t, 3, hec.ackPolls)
+		require.Equal(t, []string{
+			"11111111-2222-3333-4444-555555555555",
+			"11111111-2222-3333-4444-555555555555",
+			"11111111-2222-3333-4444-555555555555",
+		}, hec.channels)
+	})
+
+	t.Run("returns error when acknowledgment times out", func(t *testing.T) {
+		t.Parallel()
+		hec := &fakeHEC{ackAfterPolls: 1 << 30}
+		server := httptest.NewServer(hec)
+		defer server.Close()
+
+		sink, err := splunk.NewSink(server.Client(), server.URL, "test-token", splunk.SinkOptions{
+			AckChannel:      "11111111-2222-3333-4444-555555555555",
+			AckTimeout:      20 * time.Millisecond,
+			AckPollInterval: time.Millisecond,
+			Retry:           fastRetry,
+		})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "workspace-123", testData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "acknowledgments")
+	})
+}
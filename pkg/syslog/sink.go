@@ -0,0 +1,416 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/logger"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+const (
+	NetworkTCP = "tcp"
+	NetworkTLS = "tls"
+	NetworkUDP = "udp"
+)
+
+const (
+	defaultAppName  = "render-auditlogs"
+	defaultTimeout  = 30 * time.Second
+
+	severityWarning = 4
+	severityNotice  = 5
+
+	// defaultEnterpriseID is the example private enterprise number reserved
+	// for documentation by RFC 5612
+	defaultEnterpriseID = "32473"
+
+	// maxUDPMessageBytes is the largest payload of a UDP datagram over IPv4
+	maxUDPMessageBytes = 65507
+
+	timestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+	nilValue        = "-"
+)
+
+type SinkOptions struct {
+	// Hostname is reported in the HOSTNAME field, defaulting to the local
+	// hostname
+	Hostname string
+	AppName  string
+	// Facility is the numeric syslog facility, e.g. 16 for local0. The zero
+	// value is kern, and SYSLOG_FACILITY defaults to local0.
+	Facility int
+	// EnterpriseID is the IANA private enterprise number qualifying the
+	// structured data IDs, e.g. audit@32473, see RFC 5424 section 7.2.2
+	EnterpriseID string
+	// TLSCAFile is a PEM file of CAs to trust instead of the system pool when
+	// the network is tls
+	TLSCAFile string
+	// Timeout bounds connecting and writing a single message
+	Timeout time.Duration
+	Retry   retry.Policy
+}
+
+// Sink forwards audit logs as RFC 5424 syslog messages. Messages sent over TCP
+// or TLS use octet-counting framing (RFC 6587), messages sent over UDP are sent
+// one per datagram (RFC 5426).
+type Sink struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	opts      SinkOptions
+
+	// mu guards conn, which is shared by every workspace and organization
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewSinkFromConfig(ctx context.Context, cfg *env.Config) (*Sink, error) {
+	if cfg.SyslogAddress == "" {
+		return nil, fmt.Errorf("SYSLOG_ADDRESS is required for the syslog sink")
+	}
+
+	return NewSink(cfg.SyslogNetwork, cfg.SyslogAddress, SinkOptions{
+		Hostname:     cfg.SyslogHostname,
+		AppName:      cfg.SyslogAppName,
+		Facility:     cfg.SyslogFacility,
+		EnterpriseID: cfg.SyslogEnterpriseID,
+		TLSCAFile:    cfg.SyslogTLSCAFile,
+		Timeout:      cfg.SinkRequestTimeout,
+		Retry: retry.Policy{
+			MaxAttempts:    cfg.SinkRetryMaxAttempts,
+			InitialBackoff: cfg.SinkRetryInitialBackoff,
+			MaxBackoff:     cfg.SinkRetryMaxBackoff,
+		},
+	})
+}
+
+func NewSink(network, address string, opts SinkOptions) (*Sink, error) {
+	if network == "" {
+		network = NetworkTCP
+	}
+	if network != NetworkTCP && network != NetworkTLS && network != NetworkUDP {
+		return nil, fmt.Errorf("unknown syslog network %q, must be one of: tcp, tls, udp", network)
+	}
+	if opts.Facility < 0 || opts.Facility > 23 {
+		return nil, fmt.Errorf("syslog facility must be between 0 and 23, got %d", opts.Facility)
+	}
+	if opts.EnterpriseID == "" {
+		opts.EnterpriseID = defaultEnterpriseID
+	}
+	if !enterpriseIDPattern.MatchString(opts.EnterpriseID) {
+		return nil, fmt.Errorf("syslog enterprise ID must be a private enterprise number such as 32473, got %q", opts.EnterpriseID)
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.AppName == "" {
+		opts.AppName = defaultAppName
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	s := &Sink{
+		network: network,
+		address: address,
+		opts:    opts,
+	}
+
+	if network == NetworkTLS {
+		tlsConfig, err := newTLSConfig(opts.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		s.tlsConfig = tlsConfig
+	}
+
+	return s, nil
+}
+
+// UploadAuditLogs sends a syslog message per audit log, reconnecting and
+// resending a message if the connection was lost. Syslog has no
+// acknowledgments, so a message is considered delivered once it has been
+// written to the connection.
+func (s *Sink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	l := logger.FromContext(ctx)
+
+	messages := make([][]byte, 0, len(data))
+	for _, entry := range data {
+		msg, err := s.format(auditLogType, id, entry, true)
+		if err != nil {
+			return "", err
+		}
+
+		// An oversized datagram can never be sent, so rather than failing
+		// every run the metadata is dropped and the message truncated
+		if s.network == NetworkUDP && len(msg) > maxUDPMessageBytes {
+			l.Warn("syslog message exceeds the UDP datagram limit, dropping its metadata and truncating it", "id", entry.AuditLog.ID, "bytes", len(msg))
+
+			if msg, err = s.format(auditLogType, id, entry, false); err != nil {
+				return "", err
+			}
+			msg = truncate(msg, maxUDPMessageBytes)
+		}
+
+		messages = append(messages, msg)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range messages {
+		if err := retry.Do(ctx, s.opts.Retry, func() error {
+			return s.send(ctx, msg)
+		}); err != nil {
+			return "", fmt.Errorf("error sending audit logs to syslog: %w", err)
+		}
+	}
+
+	return fmt.Sprintf("syslog+%s://%s", s.network, s.address), nil
+}
+
+// Close closes the connection to the syslog server
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// send writes a single message, connecting first if needed. The connection is
+// dropped on any write error so the next attempt reconnects.
+func (s *Sink) send(ctx context.Context, msg []byte) error {
+	if s.conn != nil && !s.connected() {
+		logger.FromContext(ctx).Warn("syslog connection was closed, reconnecting", "address", s.address)
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return retry.Retryable(fmt.Errorf("error connecting to %s: %w", s.address, err), 0)
+		}
+		s.conn = conn
+	}
+
+	frame := msg
+	if s.network != NetworkUDP {
+		frame = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	if err := s.conn.SetWriteDeadline(time.Now().Add(s.opts.Timeout)); err != nil {
+		return fmt.Errorf("error setting write deadline: %w", err)
+	}
+
+	if _, err := s.conn.Write(frame); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		err = fmt.Errorf("error writing to %s: %w", s.address, err)
+		if errors.Is(err, syscall.EMSGSIZE) {
+			return err
+		}
+		return retry.Retryable(err, 0)
+	}
+
+	return nil
+}
+
+// connected reports whether a stream connection is still open. Syslog servers
+// never write to the connection, so any read result other than a timeout means
+// the server has closed it. Without this check the first write after the
+// server closes the connection would appear to succeed and be lost.
+func (s *Sink) connected() bool {
+	if s.network == NetworkUDP {
+		return true
+	}
+
+	if err := s.conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return false
+	}
+
+	var buf [1]byte
+	_, err := s.conn.Read(buf[:])
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (s *Sink) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.opts.Timeout}
+
+	if s.network == NetworkTLS {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}
+		return tlsDialer.DialContext(ctx, "tcp", s.address)
+	}
+
+	return dialer.DialContext(ctx, s.network, s.address)
+}
+
+// format builds an RFC 5424 message. The structured data carries the audit
+// log's fields and, if withMetadata is set, its metadata, and the message is
+// the audit log as JSON.
+func (s *Sink) format(auditLogType auditlogs.LogType, id string, entry render.AuditLogEntry, withMetadata bool) ([]byte, error) {
+	auditLog := entry.AuditLog
+
+	severity := severityNotice
+	if auditLog.Status != "success" {
+		severity = severityWarning
+	}
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling audit log: %w", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s ",
+		s.opts.Facility*8+severity,
+		auditLog.Timestamp.UTC().Format(timestampFormat),
+		header(s.opts.Hostname, 255),
+		header(s.opts.AppName, 48),
+		nilValue,
+		header(auditLog.Event, 32),
+	)
+
+	writeElement(&b, "audit", s.opts.EnterpriseID, [][2]string{
+		{"id", auditLog.ID},
+		{"event", auditLog.Event},
+		{"status", auditLog.Status},
+		{"logType", string(auditLogType)},
+		{"ownerID", id},
+	})
+	writeElement(&b, "actor", s.opts.EnterpriseID, [][2]string{
+		{"type", auditLog.Actor.Type},
+		{"id", auditLog.Actor.ID},
+		{"email", auditLog.Actor.Email},
+	})
+
+	if withMetadata && len(auditLog.Metadata) > 0 {
+		keys := make([]string, 0, len(auditLog.Metadata))
+		for k := range auditLog.Metadata {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		params := make([][2]string, 0, len(keys))
+		for _, k := range keys {
+			params = append(params, [2]string{k, auditLog.Metadata[k]})
+		}
+		writeElement(&b, "metadata", s.opts.EnterpriseID, params)
+	}
+
+	b.WriteByte(' ')
+	b.Write(body)
+
+	return []byte(b.String()), nil
+}
+
+// writeElement writes an SD-ELEMENT, omitting empty parameters
+func writeElement(b *strings.Builder, name, enterpriseID string, params [][2]string) {
+	b.WriteString("[" + name + "@" + enterpriseID)
+	for _, p := range params {
+		if p[1] == "" {
+			continue
+		}
+		fmt.Fprintf(b, ` %s="%s"`, paramName(p[0]), escapeParamValue(p[1]))
+	}
+	b.WriteByte(']')
+}
+
+// truncate shortens a message to at most n bytes without splitting a UTF-8
+// character. Only the trailing message body is cut, as the header and
+// structured data without metadata are far shorter than any datagram limit.
+func truncate(msg []byte, n int) []byte {
+	if len(msg) <= n {
+		return msg
+	}
+	for n > 0 && !utf8.RuneStart(msg[n]) {
+		n--
+	}
+	return msg[:n]
+}
+
+// header sanitizes a header field to printable US-ASCII of at most n
+// characters
+func header(v string, n int) string {
+	v = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, v)
+	if len(v) > n {
+		v = v[:n]
+	}
+	if v == "" {
+		return nilValue
+	}
+	return v
+}
+
+// paramName sanitizes a PARAM-NAME, which can't contain '=', ' ', ']' or '"'
+func paramName(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, v)
+	if len(v) > 32 {
+		v = v[:32]
+	}
+	return v
+}
+
+var enterpriseIDPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+var paramValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func escapeParamValue(v string) string {
+	return paramValueEscaper.Replace(v)
+}
+
+func newTLSConfig(caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading syslog CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in syslog CA file %s", caFile)
+	}
+	tlsConfig.RootCAs = pool
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,268 @@
+package syslog_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+	"github.com/renderinc/render-auditlogs/pkg/syslog"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+)
+
+var fastRetry = retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+// tcpServer receives octet-counted syslog messages, optionally closing each
+// connection after closeAfter messages
+type tcpServer struct {
+	listener   net.Listener
+	closeAfter int
+
+	mu          sync.Mutex
+	messages    []string
+	connections int
+}
+
+func newTCPServer(t *testing.T, closeAfter int) *tcpServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	s := &tcpServer{listener: listener, closeAfter: closeAfter}
+	go s.serve()
+
+	return s
+}
+
+func (s *tcpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.connections++
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *tcpServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for n := 0; s.closeAfter == 0 || n < s.closeAfter; n++ {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			return
+		}
+
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.messages = append(s.messages, string(msg))
+		s.mu.Unlock()
+	}
+}
+
+func (s *tcpServer) received(t *testing.T, n int) []string {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.messages) >= n
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func TestUploadAuditLogsTCP(t *testing.T) {
+	ctx := context.Background()
+	server := newTCPServer(t, 0)
+
+	s, err := syslog.NewSink(syslog.NetworkTCP, server.listener.Addr().String(), syslog.SinkOptions{
+		Facility: 16,
+		Hostname: "test-host",
+		Retry:    fastRetry,
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	logs := testhelpers.CreateTestAuditLogs(5, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC))
+	logs[0].AuditLog.Status = "failure"
+	logs[0].AuditLog.Metadata = map[string]string{"service name": `web "prod"]`, "region": "oregon"}
+
+	location, err := s.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", logs)
+	require.NoError(t, err)
+	require.Equal(t, "syslog+tcp://"+server.listener.Addr().String(), location)
+
+	messages := server.received(t, 5)
+	require.Len(t, messages, 5)
+
+	// local0 * 8 + warning
+	require.True(t, strings.HasPrefix(messages[0],
+		"<132>1 2024-01-15T10:00:00.000000Z test-host render-auditlogs - LoginEvent "+
+			`[audit@32473 id="`+logs[0].AuditLog.ID+`" event="LoginEvent" status="failure" logType="workspace" ownerID="tea-123"]`+
+			`[actor@32473 type="user" id="user-1" email="test@example.com"]`+
+			`[metadata@32473 region="oregon" service_name="web \"prod\"\]"] {`,
+	), messages[0])
+
+	// local0 * 8 + notice
+	require.True(t, strings.HasPrefix(messages[1], "<133>1 2024-01-15T10:01:00.000000Z "), messages[1])
+	require.NotContains(t, messages[1], "metadata@32473")
+	require.Contains(t, messages[1], `"id":"`+logs[1].AuditLog.ID+`"`)
+}
+
+func TestUploadAuditLogsReconnects(t *testing.T) {
+	ctx := context.Background()
+	server := newTCPServer(t, 3)
+
+	s, err := syslog.NewSink(syslog.NetworkTCP, server.listener.Addr().String(), syslog.SinkOptions{Retry: fastRetry})
+	require.NoError(t, err)
+	defer s.Close()
+
+	date := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	_, err = s.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(3, date))
+	require.NoError(t, err)
+	server.received(t, 3)
+
+	// Give the server time to close the connection
+	time.Sleep(50 * time.Millisecond)
+
+	logs := testhelpers.CreateTestAuditLogs(2, date)
+	_, err = s.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", logs)
+	require.NoError(t, err)
+
+	messages := server.received(t, 5)
+	require.Contains(t, messages[3], logs[0].AuditLog.ID)
+	require.Contains(t, messages[4], logs[1].AuditLog.ID)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Equal(t, 2, server.connections)
+}
+
+func TestUploadAuditLogsUDP(t *testing.T) {
+	ctx := context.Background()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	s, err := syslog.NewSink(syslog.NetworkUDP, conn.LocalAddr().String(), syslog.SinkOptions{Facility: 10, Retry: fastRetry})
+	require.NoError(t, err)
+	defer s.Close()
+
+	logs := testhelpers.CreateTestAuditLogs(2, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC))
+	_, err = s.UploadAuditLogs(ctx, auditlogs.OrganizationAuditLog, "org-456", logs)
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 65535)
+	for _, entry := range logs {
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+
+		// Datagrams are not octet-counted
+		msg := string(buf[:n])
+		require.True(t, strings.HasPrefix(msg, "<85>1 "), msg)
+		require.Contains(t, msg, `logType="organization" ownerID="org-456"`)
+		require.Contains(t, msg, entry.AuditLog.ID)
+	}
+}
+
+func TestUploadAuditLogsKernFacility(t *testing.T) {
+	ctx := context.Background()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	s, err := syslog.NewSink(syslog.NetworkUDP, conn.LocalAddr().String(), syslog.SinkOptions{Facility: 0, Retry: fastRetry})
+	require.NoError(t, err)
+	defer s.Close()
+
+	_, err = s.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(1, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)))
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 65535)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(buf[:n]), "<5>1 "), string(buf[:n]))
+}
+
+func TestUploadAuditLogsUDPTruncatesLargeMessages(t *testing.T) {
+	ctx := context.Background()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	s, err := syslog.NewSink(syslog.NetworkUDP, conn.LocalAddr().String(), syslog.SinkOptions{EnterpriseID: "12345", Retry: fastRetry})
+	require.NoError(t, err)
+	defer s.Close()
+
+	logs := testhelpers.CreateTestAuditLogs(1, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC))
+	logs[0].AuditLog.Metadata = map[string]string{"large": strings.Repeat("x", 100*1024)}
+	_, err = s.UploadAuditLogs(ctx, auditlogs.WorkspaceAuditLog, "tea-123", logs)
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 128*1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	msg := string(buf[:n])
+	require.Equal(t, 65507, n)
+	require.Contains(t, msg, `[audit@12345 id="`+logs[0].AuditLog.ID+`"`)
+	require.NotContains(t, msg, "metadata@12345")
+}
+
+func TestUploadAuditLogsFailsWhenUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	s, err := syslog.NewSink(syslog.NetworkTCP, addr, syslog.SinkOptions{Retry: fastRetry})
+	require.NoError(t, err)
+
+	_, err = s.UploadAuditLogs(context.Background(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(1, time.Now()))
+	require.ErrorContains(t, err, "error connecting")
+}
+
+func TestNewSinkRejectsInvalidOptions(t *testing.T) {
+	_, err := syslog.NewSink("unix", "/dev/log", syslog.SinkOptions{})
+	require.ErrorContains(t, err, "unknown syslog network")
+
+	_, err = syslog.NewSink(syslog.NetworkTCP, "localhost:514", syslog.SinkOptions{Facility: 24})
+	require.ErrorContains(t, err, "facility")
+
+	_, err = syslog.NewSink(syslog.NetworkTCP, "localhost:514", syslog.SinkOptions{EnterpriseID: "acme"})
+	require.ErrorContains(t, err, "enterprise ID")
+}
@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/env"
+	"github.com/renderinc/render-auditlogs/pkg/httpclient"
+	"github.com/renderinc/render-auditlogs/pkg/render"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+)
+
+const (
+	// TimestampHeader holds the Unix time the request was signed at
+	TimestampHeader = "X-Auditlogs-Timestamp"
+	// SignatureHeader holds "sha256=" followed by the hex encoded
+	// HMAC-SHA256 of "<timestamp>.<body>"
+	SignatureHeader = "X-Auditlogs-Signature"
+	// DeliveryHeader identifies a batch, it is the same across retries so
+	// receivers can discard duplicates
+	DeliveryHeader = "X-Auditlogs-Delivery"
+
+	defaultBatchSize = 100
+	defaultTimeout   = 30 * time.Second
+)
+
+type SinkOptions struct {
+	// Secret signs every request, requests are unsigned when empty
+	Secret string
+	// Headers are added to every request, e.g. for authentication
+	Headers map[string]string
+	// BatchSize is the maximum number of audit logs sent per request
+	BatchSize int
+	Retry     retry.Policy
+}
+
+// Sink posts batches of audit logs to an HTTPS endpoint
+type Sink struct {
+	httpClient *http.Client
+	url        string
+	opts       SinkOptions
+}
+
+// payload is the body of each request
+type payload struct {
+	LogType string                 `json:"log_type"`
+	OwnerID string                 `json:"owner_id"`
+	Entries []render.AuditLogEntry `json:"entries"`
+}
+
+func NewSinkFromConfig(ctx context.Context, cfg *env.Config) (*Sink, error) {
+	if cfg.WebhookURL == "" {
+		return nil, fmt.Errorf("WEBHOOK_URL is required for the webhook sink")
+	}
+
+	httpClient := &http.Client{Timeout: cfg.SinkRequestTimeout}
+
+	return NewSink(httpClient, cfg.WebhookURL, SinkOptions{
+		Secret:    cfg.WebhookSecret,
+		Headers:   cfg.WebhookHeaders,
+		BatchSize: cfg.WebhookBatchSize,
+		Retry: retry.Policy{
+			MaxAttempts:    cfg.SinkRetryMaxAttempts,
+			InitialBackoff: cfg.SinkRetryInitialBackoff,
+			MaxBackoff:     cfg.SinkRetryMaxBackoff,
+		},
+	})
+}
+
+func NewSink(httpClient *http.Client, endpoint string, opts SinkOptions) (*Sink, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("webhook URL must use https, got %q", u.Scheme)
+	}
+
+	httpClient = httpclient.WithTimeout(httpClient, defaultTimeout)
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+
+	return &Sink{
+		httpClient: httpClient,
+		url:        endpoint,
+		opts:       opts,
+	}, nil
+}
+
+// UploadAuditLogs posts audit logs in batches of at most BatchSize, in order,
+// and only returns once every batch has been accepted
+func (s *Sink) UploadAuditLogs(ctx context.Context, auditLogType auditlogs.LogType, id string, data []render.AuditLogEntry) (string, error) {
+	for start := 0; start < len(data); start += s.opts.BatchSize {
+		end := min(start+s.opts.BatchSize, len(data))
+
+		body, err := json.Marshal(payload{
+			LogType: string(auditLogType),
+			OwnerID: id,
+			Entries: data[start:end],
+		})
+		if err != nil {
+			return "", fmt.Errorf("error marshaling payload: %w", err)
+		}
+
+		delivery := sha256.Sum256(body)
+		deliveryID := hex.EncodeToString(delivery[:])
+
+		if err := retry.Do(ctx, s.opts.Retry, func() error {
+			return s.do(ctx, body, deliveryID)
+		}); err != nil {
+			return "", fmt.Errorf("error posting audit logs to webhook: %w", err)
+		}
+	}
+
+	return s.url, nil
+}
+
+// Sign returns the signature of body at timestamp, as sent in SignatureHeader
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// do performs a single request. The request is signed with the current time
+// on every attempt so retries aren't rejected as replays.
+func (s *Sink) do(ctx context.Context, body []byte, deliveryID string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	for k, v := range s.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, deliveryID)
+
+	if s.opts.Secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(SignatureHeader, Sign(s.opts.Secret, timestamp, body))
+	}
+
+	_, err = httpclient.Send(s.httpClient, req)
+	return err
+}
@@ -0,0 +1,200 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/renderinc/render-auditlogs/pkg/auditlogs"
+	"github.com/renderinc/render-auditlogs/pkg/retry"
+	"github.com/renderinc/render-auditlogs/pkg/testhelpers"
+	"github.com/renderinc/render-auditlogs/pkg/webhook"
+)
+
+const secret = "test-secret"
+
+type receivedPayload struct {
+	LogType string `json:"log_type"`
+	OwnerID string `json:"owner_id"`
+	Entries []struct {
+		Cursor   string `json:"cursor"`
+		AuditLog struct {
+			ID string `json:"id"`
+		} `json:"auditLog"`
+	} `json:"entries"`
+}
+
+// fakeReceiver verifies signatures the way a subscriber would and records the
+// payloads it accepts
+type fakeReceiver struct {
+	mu sync.Mutex
+
+	payloads   []receivedPayload
+	deliveries []string
+	headers    []http.Header
+	requests   int
+	failFirst  int
+	status     int
+}
+
+func (f *fakeReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests++
+	f.headers = append(f.headers, r.Header.Clone())
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)) > 5*time.Minute {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get(webhook.SignatureHeader) != webhook.Sign(secret, timestamp, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.deliveries = append(f.deliveries, r.Header.Get(webhook.DeliveryHeader))
+
+	if f.requests <= f.failFirst {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+
+	var p receivedPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.payloads = append(f.payloads, p)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestUploadAuditLogs(t *testing.T) {
+	t.Parallel()
+
+	testDate := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	fastRetry := retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	t.Run("posts signed batches in order", func(t *testing.T) {
+		t.Parallel()
+		receiver := &fakeReceiver{}
+		server := httptest.NewTLSServer(receiver)
+		defer server.Close()
+
+		testData := testhelpers.CreateTestAuditLogs(5, testDate)
+
+		sink, err := webhook.NewSink(server.Client(), server.URL, webhook.SinkOptions{
+			Secret:    secret,
+			Headers:   map[string]string{"Authorization": "Bearer abc123"},
+			BatchSize: 2,
+			Retry:     fastRetry,
+		})
+		require.NoError(t, err)
+
+		location, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testData)
+		require.NoError(t, err)
+		require.Equal(t, server.URL, location)
+
+		require.Len(t, receiver.payloads, 3)
+		require.Len(t, receiver.payloads[0].Entries, 2)
+		require.Len(t, receiver.payloads[1].Entries, 2)
+		require.Len(t, receiver.payloads[2].Entries, 1)
+
+		var i int
+		for _, p := range receiver.payloads {
+			require.Equal(t, "workspace", p.LogType)
+			require.Equal(t, "tea-123", p.OwnerID)
+			for _, entry := range p.Entries {
+				require.Equal(t, testData[i].Cursor, entry.Cursor)
+				require.Equal(t, testData[i].AuditLog.ID, entry.AuditLog.ID)
+				i++
+			}
+		}
+
+		for _, h := range receiver.headers {
+			require.Equal(t, "Bearer abc123", h.Get("Authorization"))
+			require.Equal(t, "application/json", h.Get("Content-Type"))
+		}
+	})
+
+	t.Run("retries server errors with the same delivery ID", func(t *testing.T) {
+		t.Parallel()
+		receiver := &fakeReceiver{failFirst: 2}
+		server := httptest.NewTLSServer(receiver)
+		defer server.Close()
+
+		sink, err := webhook.NewSink(server.Client(), server.URL, webhook.SinkOptions{Secret: secret, Retry: fastRetry})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.OrganizationAuditLog, "org-456", testhelpers.CreateTestAuditLogs(3, testDate))
+		require.NoError(t, err)
+
+		require.Equal(t, 3, receiver.requests)
+		require.Len(t, receiver.payloads, 1)
+		require.Len(t, receiver.deliveries, 3)
+		require.NotEmpty(t, receiver.deliveries[0])
+		require.Equal(t, receiver.deliveries[0], receiver.deliveries[1])
+		require.Equal(t, receiver.deliveries[0], receiver.deliveries[2])
+	})
+
+	t.Run("returns error when the signature is rejected", func(t *testing.T) {
+		t.Parallel()
+		receiver := &fakeReceiver{}
+		server := httptest.NewTLSServer(receiver)
+		defer server.Close()
+
+		sink, err := webhook.NewSink(server.Client(), server.URL, webhook.SinkOptions{Secret: "wrong-secret", Retry: fastRetry})
+		require.NoError(t, err)
+
+		_, err = sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(1, testDate))
+		require.ErrorContains(t, err, "status 401")
+		require.Equal(t, 1, receiver.requests)
+	})
+
+	t.Run("returns error when logs are rejected", func(t *testing.T) {
+		t.Parallel()
+		receiver := &fakeReceiver{status: http.StatusUnprocessableEntity}
+		server := httptest.NewTLSServer(receiver)
+		defer server.Close()
+
+		sink, err := webhook.NewSink(server.Client(), server.URL, webhook.SinkOptions{Secret: secret, Retry: fastRetry})
+		require.NoError(t, err)
+
+		location, err := sink.UploadAuditLogs(t.Context(), auditlogs.WorkspaceAuditLog, "tea-123", testhelpers.CreateTestAuditLogs(1, testDate))
+		require.ErrorContains(t, err, "status 422")
+		require.Empty(t, location)
+		require.Equal(t, 1, receiver.requests)
+	})
+}
+
+func TestNewSinkRequiresHTTPS(t *testing.T) {
+	_, err := webhook.NewSink(nil, "http://hooks.internal/render-audit", webhook.SinkOptions{})
+	require.ErrorContains(t, err, "must use https")
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac test-secret
+	require.Equal(t,
+		"sha256=8cb2c3355fca388e9ac2caec004f4d5d7045d74937ab5faad61dc11682247a9f",
+		webhook.Sign(secret, 1700000000, []byte(`{"a":1}`)),
+	)
+}